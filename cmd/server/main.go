@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/exchange"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"log"
+	"net"
+	"os"
+)
+
+func main() {
+	address := flag.String("address", exchange.DefaultAddress, "address to listen on")
+	bitSize := flag.Int("bits", 2048, fmt.Sprintf("RSA modulus size of server keys, at least %d", exchange.MinKeySize))
+	flag.Parse()
+
+	keys, err := rsa.GenerateKeys(*bitSize)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server, err := exchange.NewServer(keys, exchange.EchoHandler)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.Logger = log.New(os.Stderr, "server: ", log.LstdFlags)
+
+	listener, err := net.Listen("tcp", *address)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.Logger.Printf("listening on %s with %d-bit RSA key", listener.Addr(), *bitSize)
+
+	if err := server.Serve(listener); err != nil {
+		log.Fatal(err)
+	}
+}
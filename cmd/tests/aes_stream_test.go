@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"github.com/mesiriak/cyphering/pkg/aes"
+	"io"
+	"testing"
+)
+
+const streamChunkSize = 64
+
+// Encrypts plaintext into a stream, writing it in pieces of irregular size.
+func encryptStream(t *testing.T, key, plaintext []byte, keyID string) []byte {
+	var output bytes.Buffer
+	writer, err := aes.NewStreamWriter(&output, key, keyID, streamChunkSize)
+	if err != nil {
+		t.Fatalf("NewStreamWriter failed: %v", err)
+	}
+	for remaining, piece := plaintext, 1; len(remaining) > 0; piece = piece*3 + 1 {
+		n := min(piece, len(remaining))
+		if _, err := writer.Write(remaining[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		remaining = remaining[n:]
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return output.Bytes()
+}
+
+func decryptStream(key, stream []byte) ([]byte, error) {
+	reader, err := aes.NewStreamReader(bytes.NewReader(stream), key)
+	if err != nil {
+		return nil, err
+	}
+	// Small reads exercise data left over between chunks.
+	var output bytes.Buffer
+	buffer := make([]byte, 7)
+	for {
+		n, err := reader.Read(buffer)
+		output.Write(buffer[:n])
+		if errors.Is(err, io.EOF) {
+			return output.Bytes(), nil
+		}
+		if err != nil {
+			return output.Bytes(), err
+		}
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	for _, keySize := range []int{128, 192, 256} {
+		key, _ := aes.GenerateRandomKey(keySize)
+
+		for _, size := range []int{0, 1, streamChunkSize - 1, streamChunkSize, streamChunkSize + 1, 3 * streamChunkSize, 1000} {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+
+			stream := encryptStream(t, key, plaintext, "key-1")
+			decrypted, err := decryptStream(key, stream)
+			if err != nil {
+				t.Fatalf("AES-%d, %d bytes: decryption failed: %v", keySize, size, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("AES-%d, %d bytes: round trip mismatch", keySize, size)
+			}
+		}
+	}
+}
+
+func TestStreamHeaderAndKeyLookup(t *testing.T) {
+	keys := map[string][]byte{}
+	keys["old"], _ = aes.GenerateRandomKey(128)
+	keys["new"], _ = aes.GenerateRandomKey(256)
+
+	stream := encryptStream(t, keys["new"], []byte("rotated"), "new")
+
+	reader, err := aes.NewStreamReaderWithKeyLookup(bytes.NewReader(stream), func(keyID string) ([]byte, error) {
+		key, ok := keys[keyID]
+		if !ok {
+			return nil, errors.New("unknown key")
+		}
+		return key, nil
+	})
+	if err != nil {
+		t.Fatalf("NewStreamReaderWithKeyLookup failed: %v", err)
+	}
+	header := reader.Header()
+	if header.KeyID != "new" || header.Version != aes.StreamVersion || header.Mode != aes.StreamModeGCM || header.ChunkSize != streamChunkSize {
+		t.Errorf("Unexpected header %+v", header)
+	}
+	if decrypted, err := io.ReadAll(reader); err != nil || string(decrypted) != "rotated" {
+		t.Errorf("Expected rotated, got %q, %v", decrypted, err)
+	}
+
+	if _, err := decryptStream(keys["old"], stream); !errors.Is(err, aes.ErrTagMismatch) {
+		t.Errorf("Expected ErrTagMismatch for wrong key, got %v", err)
+	}
+}
+
+func TestStreamDetectsModification(t *testing.T) {
+	key, _ := aes.GenerateRandomKey(256)
+	plaintext := make([]byte, 3*streamChunkSize+10)
+	rand.Read(plaintext)
+	stream := encryptStream(t, key, plaintext, "id")
+
+	// Header is magic, version, mode, key ID length, key ID "id", nonce prefix and chunk size.
+	headerSize := 4 + 3 + 2 + 7 + 4
+	chunk := streamChunkSize + aes.GCMTagSize
+	chunkAt := func(i int) []byte { return stream[headerSize+i*chunk : min(headerSize+(i+1)*chunk, len(stream))] }
+
+	concat := func(parts ...[]byte) []byte {
+		var result []byte
+		for _, part := range parts {
+			result = append(result, part...)
+		}
+		return result
+	}
+	flipped := func(offset int) []byte {
+		modified := bytes.Clone(stream)
+		modified[offset] ^= 1
+		return modified
+	}
+
+	cases := []struct {
+		name     string
+		stream   []byte
+		expected error
+	}{
+		{"cut at chunk boundary", stream[:headerSize+2*chunk], aes.ErrStreamTruncated},
+		{"cut after header", stream[:headerSize], aes.ErrStreamTruncated},
+		{"cut inside chunk", stream[:headerSize+chunk+20], aes.ErrTagMismatch},
+		{"reordered chunks", concat(stream[:headerSize], chunkAt(1), chunkAt(0), chunkAt(2), chunkAt(3)), aes.ErrTagMismatch},
+		{"dropped chunk", concat(stream[:headerSize], chunkAt(0), chunkAt(2), chunkAt(3)), aes.ErrTagMismatch},
+		{"duplicated chunk", concat(stream[:headerSize], chunkAt(0), chunkAt(0), chunkAt(1), chunkAt(2), chunkAt(3)), aes.ErrTagMismatch},
+		{"appended data", concat(stream, []byte{0}), aes.ErrTagMismatch},
+		{"tampered ciphertext", flipped(headerSize + chunk + 5), aes.ErrTagMismatch},
+		{"tampered tag", flipped(len(stream) - 1), aes.ErrTagMismatch},
+		{"tampered key ID", flipped(7), aes.ErrTagMismatch},
+		{"tampered nonce prefix", flipped(10), aes.ErrTagMismatch},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			decrypted, err := decryptStream(key, testCase.stream)
+			if !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected %v, got %v", testCase.expected, err)
+			}
+			// Only authenticated chunks are returned before the error.
+			if !bytes.HasPrefix(plaintext, decrypted) {
+				t.Error("Reader returned unauthenticated data")
+			}
+		})
+	}
+
+	// Malformed headers are rejected before any key is used.
+	for name, header := range map[string][]byte{
+		"magic":      flipped(0),
+		"version":    flipped(4),
+		"mode":       flipped(5),
+		"chunk size": concat(stream[:headerSize-4], []byte{0, 0, 0, 0}),
+		"short":      stream[:5],
+	} {
+		if _, err := aes.NewStreamReader(bytes.NewReader(header), key); err == nil {
+			t.Errorf("Expected error for malformed %s", name)
+		}
+	}
+}
+
+func BenchmarkStreamWriter(b *testing.B) {
+	key, _ := aes.GenerateRandomKey(256)
+	data := make([]byte, benchmarkSize)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		writer, _ := aes.NewStreamWriter(io.Discard, key, "", 0)
+		writer.Write(data)
+		writer.Close()
+	}
+}
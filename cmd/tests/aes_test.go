@@ -2,8 +2,11 @@ package tests
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"encoding/hex"
+	"errors"
 	"github.com/mesiriak/cyphering/pkg/aes"
+	mathrand "math/rand"
 	"testing"
 )
 
@@ -84,3 +87,506 @@ func TestAESRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestAESCBCKnownVector(t *testing.T) {
+	// NIST SP 800-38A, F.2.1 CBC-AES128.Encrypt.
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	iv, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	plaintext, _ := hex.DecodeString(
+		"6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+			"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710",
+	)
+	expectedCiphertext, _ := hex.DecodeString(
+		"7649abac8119b246cee98e9b12e9197d5086cb9b507219ee95db113a917678b2" +
+			"73bed6b8e3c1743b7116e69e222295163ff1caa1681fac09120eca307586e1a7",
+	)
+
+	ciphertext, err := aes.EncryptCBCWithIV(plaintext, key, 128, iv)
+	if err != nil {
+		t.Fatalf("EncryptCBCWithIV failed: %v", err)
+	}
+	// The last block holds PKCS#7 padding, which is not part of the vector.
+	if !bytes.Equal(ciphertext[:len(expectedCiphertext)], expectedCiphertext) {
+		t.Errorf("CBC known vector test failed: got %x, expected %x", ciphertext, expectedCiphertext)
+	}
+
+	decrypted, err := aes.DecryptCBCWithIV(ciphertext, key, 128, iv)
+	if err != nil {
+		t.Fatalf("DecryptCBCWithIV failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("CBC known vector decryption failed: got %x, expected %x", decrypted, plaintext)
+	}
+}
+
+func TestAESCBCRoundTrip(t *testing.T) {
+	key := []byte("thisis32bytekeyforaes256encrypt!")
+	// Two identical blocks must not produce identical ciphertext blocks.
+	plaintext := bytes.Repeat([]byte("sixteen byte blk"), 2)
+
+	first, err := aes.EncryptCBC(plaintext, key, 256)
+	if err != nil {
+		t.Fatalf("EncryptCBC failed: %v", err)
+	}
+	second, err := aes.EncryptCBC(plaintext, key, 256)
+	if err != nil {
+		t.Fatalf("EncryptCBC failed: %v", err)
+	}
+	if bytes.Equal(first, second) {
+		t.Error("two encryptions of the same message must differ")
+	}
+	if bytes.Equal(first[16:32], first[32:48]) {
+		t.Error("identical plaintext blocks produced identical ciphertext blocks")
+	}
+
+	decrypted, err := aes.DecryptCBC(first, key, 256)
+	if err != nil {
+		t.Fatalf("DecryptCBC failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("CBC round-trip failed: got %q, expected %q", decrypted, plaintext)
+	}
+}
+
+func TestAESCTRKnownVector(t *testing.T) {
+	// NIST SP 800-38A, F.5.1 CTR-AES128.Encrypt.
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	iv, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	plaintext, _ := hex.DecodeString(
+		"6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+			"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710",
+	)
+	expectedCiphertext, _ := hex.DecodeString(
+		"874d6191b620e3261bef6864990db6ce9806f66b7970fdff8617187bb9fffdff" +
+			"5ae4df3edbd5d35e5b4f09020db03eab1e031dda2fbe03d1792170a0f3009cee",
+	)
+
+	ciphertext, err := aes.EncryptCTR(plaintext, key, 128, iv)
+	if err != nil {
+		t.Fatalf("EncryptCTR failed: %v", err)
+	}
+	if !bytes.Equal(ciphertext, expectedCiphertext) {
+		t.Errorf("CTR known vector test failed: got %x, expected %x", ciphertext, expectedCiphertext)
+	}
+
+	// Lengths which are not multiple of the block size are not padded.
+	for _, length := range []int{0, 1, 15, 17, 63} {
+		partial, err := aes.EncryptCTR(plaintext[:length], key, 128, iv)
+		if err != nil {
+			t.Fatalf("EncryptCTR failed: %v", err)
+		}
+		if !bytes.Equal(partial, expectedCiphertext[:length]) {
+			t.Errorf("CTR partial encryption of %d bytes failed: got %x", length, partial)
+		}
+		decrypted, err := aes.DecryptCTR(partial, key, 128, iv)
+		if err != nil {
+			t.Fatalf("DecryptCTR failed: %v", err)
+		}
+		if !bytes.Equal(decrypted, plaintext[:length]) {
+			t.Errorf("CTR partial decryption of %d bytes failed: got %x", length, decrypted)
+		}
+	}
+}
+
+func TestAESGCMKnownVectors(t *testing.T) {
+	// Test cases 2 and 4 from the GCM specification by McGrew and Viega.
+	testCases := []struct {
+		name           string
+		keyHex         string
+		nonceHex       string
+		plaintextHex   string
+		additionalHex  string
+		ciphertextHex  string
+		expectedTagHex string
+	}{
+		{
+			name:           "Zero key and block",
+			keyHex:         "00000000000000000000000000000000",
+			nonceHex:       "000000000000000000000000",
+			plaintextHex:   "00000000000000000000000000000000",
+			ciphertextHex:  "0388dace60b6a392f328c2b971b2fe78",
+			expectedTagHex: "ab6e47d42cec13bdf53a67b21257bddf",
+		},
+		{
+			name:     "Additional data and partial block",
+			keyHex:   "feffe9928665731c6d6a8f9467308308",
+			nonceHex: "cafebabefacedbaddecaf888",
+			plaintextHex: "d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a72" +
+				"1c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+			additionalHex: "feedfacedeadbeeffeedfacedeadbeefabaddad2",
+			ciphertextHex: "42831ec2217774244b7221b784d0d49ce3aa212f2c02a4e035c17e2329aca12e" +
+				"21d514b25466931c7d8f6a5aac84aa051ba30b396a0aac973d58e091",
+			expectedTagHex: "5bc94fbc3221a5db94fae95ae7121a47",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, _ := hex.DecodeString(tc.keyHex)
+			nonce, _ := hex.DecodeString(tc.nonceHex)
+			plaintext, _ := hex.DecodeString(tc.plaintextHex)
+			additionalData, _ := hex.DecodeString(tc.additionalHex)
+			expected, _ := hex.DecodeString(tc.ciphertextHex + tc.expectedTagHex)
+
+			sealed, err := aes.SealGCM(plaintext, key, 128, nonce, additionalData)
+			if err != nil {
+				t.Fatalf("SealGCM failed: %v", err)
+			}
+			if !bytes.Equal(sealed, expected) {
+				t.Errorf("GCM known vector test failed: got %x, expected %x", sealed, expected)
+			}
+
+			opened, err := aes.OpenGCM(sealed, key, 128, nonce, additionalData)
+			if err != nil {
+				t.Fatalf("OpenGCM failed: %v", err)
+			}
+			if !bytes.Equal(opened, plaintext) {
+				t.Errorf("GCM known vector decryption failed: got %x, expected %x", opened, plaintext)
+			}
+
+			// Expanded key gives the same result and can be reused.
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				t.Fatalf("NewCipher failed: %v", err)
+			}
+			for i := 0; i < 2; i++ {
+				sealed, err := block.SealGCM(plaintext, nonce, additionalData)
+				if err != nil || !bytes.Equal(sealed, expected) {
+					t.Errorf("Cipher.SealGCM known vector test failed: got %x, %v", sealed, err)
+				}
+				opened, err := block.OpenGCM(expected, nonce, additionalData)
+				if err != nil || !bytes.Equal(opened, plaintext) {
+					t.Errorf("Cipher.OpenGCM known vector decryption failed: got %x, %v", opened, err)
+				}
+			}
+			if _, err := block.SealGCM(plaintext, nonce[:8], additionalData); err == nil {
+				t.Error("Expected error for short nonce")
+			}
+		})
+	}
+}
+
+func TestAESGCMTampering(t *testing.T) {
+	key := []byte("thisis24bytekeyforaes192")
+	nonce := []byte("twelve bytes")
+	additionalData := []byte("header")
+
+	sealed, err := aes.SealGCM([]byte("Test message for AES-GCM."), key, 192, nonce, additionalData)
+	if err != nil {
+		t.Fatalf("SealGCM failed: %v", err)
+	}
+
+	for i := range sealed {
+		tampered := append([]byte(nil), sealed...)
+		tampered[i] ^= 0x01
+		if _, err := aes.OpenGCM(tampered, key, 192, nonce, additionalData); !errors.Is(err, aes.ErrTagMismatch) {
+			t.Fatalf("flipped byte %d: expected tag mismatch, got %v", i, err)
+		}
+	}
+
+	if _, err := aes.OpenGCM(sealed, key, 192, nonce, []byte("other header")); !errors.Is(err, aes.ErrTagMismatch) {
+		t.Errorf("modified additional data: expected tag mismatch, got %v", err)
+	}
+}
+
+func TestAESCipherBlockInterop(t *testing.T) {
+	key := []byte("thisis16bytekey!")
+	iv := []byte("initial vector!!")
+	nonce := []byte("twelve bytes")
+	plaintext := bytes.Repeat([]byte("sixteen byte blk"), 4)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher failed: %v", err)
+	}
+
+	// CBC through the standard library must match the package's own CBC (without padding block).
+	expectedCBC, err := aes.EncryptCBCWithIV(plaintext, key, 128, iv)
+	if err != nil {
+		t.Fatalf("EncryptCBCWithIV failed: %v", err)
+	}
+	cbc := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(cbc, plaintext)
+	if !bytes.Equal(cbc, expectedCBC[:len(plaintext)]) {
+		t.Errorf("cipher.NewCBCEncrypter mismatch: got %x, expected %x", cbc, expectedCBC[:len(plaintext)])
+	}
+
+	// GCM through the standard library must match the package's own GCM.
+	expectedGCM, err := aes.SealGCM(plaintext, key, 128, nonce, iv)
+	if err != nil {
+		t.Fatalf("SealGCM failed: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM failed: %v", err)
+	}
+	if sealed := gcm.Seal(nil, nonce, plaintext, iv); !bytes.Equal(sealed, expectedGCM) {
+		t.Errorf("cipher.NewGCM mismatch: got %x, expected %x", sealed, expectedGCM)
+	}
+
+	if _, err := aes.NewCipher(key[:10]); err == nil {
+		t.Error("expected error for invalid key size")
+	}
+}
+
+func TestAESBytesRoundTrip(t *testing.T) {
+	key := []byte("thisis16bytekey!")
+	// Binary data with zero bytes and invalid UTF-8.
+	data := []byte{0x00, 0xff, 0xfe, 0x00, 0x80, 0x01, 0x02}
+
+	encrypted, err := aes.EncryptBytes(data, key, 128)
+	if err != nil {
+		t.Fatalf("EncryptBytes failed: %v", err)
+	}
+	decrypted, err := aes.DecryptBytes(encrypted, key, 128)
+	if err != nil {
+		t.Fatalf("DecryptBytes failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("Bytes round-trip failed: got %x, expected %x", decrypted, data)
+	}
+
+	// String helpers must stay compatible with the byte API.
+	encryptedString, err := aes.Encrypt(string(data), key, 128)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	if encryptedString != string(encrypted) {
+		t.Errorf("Encrypt and EncryptBytes mismatch: got %x, expected %x", encryptedString, encrypted)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("entropy source is broken")
+}
+
+func TestAESGenerateKey(t *testing.T) {
+	source := bytes.Repeat([]byte{0xab}, 32)
+
+	key, err := aes.GenerateKey(bytes.NewReader(source), 256)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if !bytes.Equal(key, source) {
+		t.Errorf("GenerateKey must read the key from the given source: got %x", key)
+	}
+
+	if _, err := aes.GenerateKey(failingReader{}, 128); err == nil {
+		t.Error("expected error for failing entropy source")
+	}
+	if _, err := aes.GenerateKey(bytes.NewReader(source[:8]), 128); err == nil {
+		t.Error("expected error for short entropy source")
+	}
+	if _, err := aes.GenerateKey(bytes.NewReader(source), 100); err == nil {
+		t.Error("expected error for invalid key size")
+	}
+
+	first, err := aes.GenerateRandomKey(128)
+	if err != nil {
+		t.Fatalf("GenerateRandomKey failed: %v", err)
+	}
+	second, err := aes.GenerateRandomKey(128)
+	if err != nil {
+		t.Fatalf("GenerateRandomKey failed: %v", err)
+	}
+	if bytes.Equal(first, second) {
+		t.Error("two generated keys must differ")
+	}
+}
+
+func TestAESCipherMatchesReference(t *testing.T) {
+	random := mathrand.New(mathrand.NewSource(1))
+
+	for _, keySize := range []int{128, 192, 256} {
+		key := make([]byte, keySize/8)
+		random.Read(key)
+
+		w, Nr, err := aes.KeyExpansion(key, keySize)
+		if err != nil {
+			t.Fatalf("KeyExpansion failed: %v", err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatalf("NewCipher failed: %v", err)
+		}
+
+		input := make([]byte, 16)
+		output := make([]byte, 16)
+		for i := 0; i < 1000; i++ {
+			random.Read(input)
+
+			block.Encrypt(output, input)
+			if expected := aes.EncryptBlock(input, w, Nr); !bytes.Equal(output, expected) {
+				t.Fatalf("AES-%d encryption of %x: got %x, expected %x", keySize, input, output, expected)
+			}
+			block.Decrypt(output, input)
+			if expected := aes.DecryptBlock(input, w, Nr); !bytes.Equal(output, expected) {
+				t.Fatalf("AES-%d decryption of %x: got %x, expected %x", keySize, input, output, expected)
+			}
+		}
+	}
+}
+
+const benchmarkSize = 1 << 20
+
+func BenchmarkAESEncryptReference(b *testing.B) {
+	key := []byte("thisis16bytekey!")
+	data := make([]byte, benchmarkSize)
+	w, Nr, _ := aes.KeyExpansion(key, 128)
+
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(data); j += 16 {
+			copy(data[j:], aes.EncryptBlock(data[j:j+16], w, Nr))
+		}
+	}
+}
+
+func BenchmarkAESEncryptTables(b *testing.B) {
+	key := []byte("thisis16bytekey!")
+	data := make([]byte, benchmarkSize)
+	block, _ := aes.NewCipher(key)
+
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(data); j += 16 {
+			block.Encrypt(data[j:], data[j:])
+		}
+	}
+}
+
+func BenchmarkAESDecryptReference(b *testing.B) {
+	key := []byte("thisis16bytekey!")
+	data := make([]byte, benchmarkSize)
+	w, Nr, _ := aes.KeyExpansion(key, 128)
+
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(data); j += 16 {
+			copy(data[j:], aes.DecryptBlock(data[j:j+16], w, Nr))
+		}
+	}
+}
+
+func BenchmarkAESDecryptTables(b *testing.B) {
+	key := []byte("thisis16bytekey!")
+	data := make([]byte, benchmarkSize)
+	block, _ := aes.NewCipher(key)
+
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(data); j += 16 {
+			block.Decrypt(data[j:], data[j:])
+		}
+	}
+}
+
+func TestAESCoresFIPS197Vectors(t *testing.T) {
+	// FIPS-197 Appendix B and Appendix C vectors.
+	testCases := []struct {
+		name          string
+		keyHex        string
+		plaintextHex  string
+		ciphertextHex string
+	}{
+		{"Appendix B", "2b7e151628aed2a6abf7158809cf4f3c", "3243f6a8885a308d313198a2e0370734", "3925841d02dc09fbdc118597196a0b32"},
+		{"AES-128", "000102030405060708090a0b0c0d0e0f", "00112233445566778899aabbccddeeff", "69c4e0d86a7b0430d8cdb78070b4c55a"},
+		{"AES-192", "000102030405060708090a0b0c0d0e0f1011121314151617", "00112233445566778899aabbccddeeff", "dda97ca4864cdfe06eaf70a0ec0d7191"},
+		{"AES-256", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "00112233445566778899aabbccddeeff", "8ea2b7ca516745bfeafc49904b496089"},
+	}
+	cores := map[string]aes.Core{"Table": aes.TableCore, "ConstantTime": aes.ConstantTimeCore}
+
+	for coreName, core := range cores {
+		for _, tc := range testCases {
+			t.Run(coreName+" "+tc.name, func(t *testing.T) {
+				key, _ := hex.DecodeString(tc.keyHex)
+				plaintext, _ := hex.DecodeString(tc.plaintextHex)
+				expectedCiphertext, _ := hex.DecodeString(tc.ciphertextHex)
+
+				block, err := aes.NewCipherWithCore(key, core)
+				if err != nil {
+					t.Fatalf("NewCipherWithCore failed: %v", err)
+				}
+
+				ciphertext := make([]byte, 16)
+				block.Encrypt(ciphertext, plaintext)
+				if !bytes.Equal(ciphertext, expectedCiphertext) {
+					t.Errorf("encryption failed: got %x, expected %x", ciphertext, expectedCiphertext)
+				}
+
+				decrypted := make([]byte, 16)
+				block.Decrypt(decrypted, ciphertext)
+				if !bytes.Equal(decrypted, plaintext) {
+					t.Errorf("decryption failed: got %x, expected %x", decrypted, plaintext)
+				}
+			})
+		}
+	}
+}
+
+func TestAESConstantTimeCoreMatchesReference(t *testing.T) {
+	random := mathrand.New(mathrand.NewSource(2))
+
+	for _, keySize := range []int{128, 192, 256} {
+		key := make([]byte, keySize/8)
+		random.Read(key)
+
+		w, Nr, err := aes.KeyExpansion(key, keySize)
+		if err != nil {
+			t.Fatalf("KeyExpansion failed: %v", err)
+		}
+		block, err := aes.NewCipherWithCore(key, aes.ConstantTimeCore)
+		if err != nil {
+			t.Fatalf("NewCipherWithCore failed: %v", err)
+		}
+
+		input := make([]byte, 16)
+		output := make([]byte, 16)
+		for i := 0; i < 200; i++ {
+			random.Read(input)
+
+			block.Encrypt(output, input)
+			if expected := aes.EncryptBlock(input, w, Nr); !bytes.Equal(output, expected) {
+				t.Fatalf("AES-%d encryption of %x: got %x, expected %x", keySize, input, output, expected)
+			}
+			block.Decrypt(output, input)
+			if expected := aes.DecryptBlock(input, w, Nr); !bytes.Equal(output, expected) {
+				t.Fatalf("AES-%d decryption of %x: got %x, expected %x", keySize, input, output, expected)
+			}
+		}
+	}
+}
+
+func BenchmarkAESEncryptConstantTime(b *testing.B) {
+	key := []byte("thisis16bytekey!")
+	data := make([]byte, benchmarkSize)
+	block, _ := aes.NewCipherWithCore(key, aes.ConstantTimeCore)
+
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(data); j += 16 {
+			block.Encrypt(data[j:], data[j:])
+		}
+	}
+}
+
+func BenchmarkAESDecryptConstantTime(b *testing.B) {
+	key := []byte("thisis16bytekey!")
+	data := make([]byte, benchmarkSize)
+	block, _ := aes.NewCipherWithCore(key, aes.ConstantTimeCore)
+
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(data); j += 16 {
+			block.Decrypt(data[j:], data[j:])
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"github.com/mesiriak/cyphering/pkg/aes"
+	"github.com/mesiriak/cyphering/pkg/channel"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"io"
+	"net"
+	"testing"
+)
+
+func channelKeys(t *testing.T) (*rsa.Keys, []byte) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	fingerprint, err := channel.Fingerprint(keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+	return keys, fingerprint
+}
+
+func TestChannelRoundTrip(t *testing.T) {
+	keys, fingerprint := channelKeys(t)
+	clientConn, serverConn := net.Pipe()
+
+	// Larger than one record, so writes are split.
+	message := make([]byte, 3*channel.MaxRecordSize+100)
+	rand.Read(message)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		server, err := channel.Server(nil, serverConn, keys)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		received := make([]byte, len(message))
+		if _, err := io.ReadFull(server, received); err != nil {
+			serverErr <- err
+			return
+		}
+		if _, err := server.Write(bytes.ToUpper(received)); err != nil {
+			serverErr <- err
+			return
+		}
+		serverErr <- server.Close()
+	}()
+
+	client, err := channel.Client(nil, clientConn, fingerprint)
+	if err != nil {
+		t.Fatalf("Client handshake failed: %v", err)
+	}
+	if _, err := client.Write(message); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	response, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(response, bytes.ToUpper(message)) {
+		t.Error("Response does not match")
+	}
+	if err := <-serverErr; err != nil {
+		t.Fatalf("Server failed: %v", err)
+	}
+}
+
+func TestChannelFingerprintMismatch(t *testing.T) {
+	keys, _ := channelKeys(t)
+	_, otherFingerprint := channelKeys(t)
+	clientConn, serverConn := net.Pipe()
+
+	go func() {
+		channel.Server(nil, serverConn, keys)
+		serverConn.Close()
+	}()
+
+	_, err := channel.Client(nil, clientConn, otherFingerprint)
+	clientConn.Close()
+	if !errors.Is(err, channel.ErrFingerprintMismatch) {
+		t.Errorf("Expected ErrFingerprintMismatch, got %v", err)
+	}
+}
+
+// Forwards server hello and finished record to the client, then collects the rest of
+// server records and writes them after mutate changes them.
+func relayServerRecords(src io.Reader, dst io.WriteCloser, mutate func([][]byte) [][]byte) {
+	defer dst.Close()
+
+	hello := make([]byte, 1+32+2)
+	if _, err := io.ReadFull(src, hello); err != nil {
+		return
+	}
+	spki := make([]byte, binary.BigEndian.Uint16(hello[33:]))
+	io.ReadFull(src, spki)
+	dst.Write(append(hello, spki...))
+
+	var records [][]byte
+	for {
+		header := make([]byte, 13)
+		if _, err := io.ReadFull(src, header); err != nil {
+			break
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[9:]))
+		io.ReadFull(src, body)
+		record := append(header, body...)
+
+		if binary.BigEndian.Uint64(header[1:]) == 0 {
+			dst.Write(record)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	for _, record := range mutate(records) {
+		dst.Write(record)
+	}
+}
+
+func TestChannelDetectsAttacks(t *testing.T) {
+	keys, fingerprint := channelKeys(t)
+
+	// Server sends data records 1, 2, 3 and close record 4.
+	cases := []struct {
+		name     string
+		mutate   func([][]byte) [][]byte
+		expected error
+	}{
+		{"untouched", func(r [][]byte) [][]byte { return r }, nil},
+		{"truncated", func(r [][]byte) [][]byte { return r[:len(r)-1] }, channel.ErrTruncated},
+		{"dropped", func(r [][]byte) [][]byte { return append(r[:1:1], r[2:]...) }, channel.ErrReplay},
+		{"replayed", func(r [][]byte) [][]byte { return append([][]byte{r[0], r[0]}, r[1:]...) }, channel.ErrReplay},
+		{"reordered", func(r [][]byte) [][]byte { return [][]byte{r[1], r[0], r[2], r[3]} }, channel.ErrReplay},
+		{"reordered with rewritten sequence", func(r [][]byte) [][]byte {
+			copy(r[0][1:9], r[1][1:9])
+			binary.BigEndian.PutUint64(r[1][1:9], 1)
+			return [][]byte{r[1], r[0], r[2], r[3]}
+		}, aes.ErrTagMismatch},
+		{"tampered", func(r [][]byte) [][]byte {
+			r[1][20] ^= 1
+			return r
+		}, aes.ErrTagMismatch},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			clientConn, relayClient := net.Pipe()
+			relayServer, serverConn := net.Pipe()
+			go io.Copy(relayServer, relayClient)
+			go relayServerRecords(relayServer, relayClient, testCase.mutate)
+
+			go func() {
+				server, err := channel.Server(nil, serverConn, keys)
+				if err != nil {
+					serverConn.Close()
+					return
+				}
+				for _, part := range []string{"first ", "second ", "third"} {
+					server.Write([]byte(part))
+				}
+				server.Close()
+			}()
+
+			client, err := channel.Client(nil, clientConn, fingerprint)
+			if err != nil {
+				t.Fatalf("Client handshake failed: %v", err)
+			}
+			defer clientConn.Close()
+
+			received, err := io.ReadAll(client)
+			if testCase.expected == nil {
+				if err != nil || string(received) != "first second third" {
+					t.Errorf("Expected full message, got %q, %v", received, err)
+				}
+				return
+			}
+			if !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected %v, got %v", testCase.expected, err)
+			}
+			// Failure is permanent.
+			if _, err := client.Read(make([]byte, 1)); !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected repeated %v, got %v", testCase.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/mesiriak/cyphering/internal/cli"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs CLI with given stdin and returns stdout, failing the test on unexpected exit code.
+func runCLI(t *testing.T, stdin string, expectedCode int, args ...string) string {
+	var stdout, stderr bytes.Buffer
+	code := cli.Run(args, strings.NewReader(stdin), &stdout, &stderr)
+	if code != expectedCode {
+		t.Fatalf("cyphering %v exited with %d, expected %d: %s", args, code, expectedCode, stderr.String())
+	}
+	return stdout.String()
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestCLIRSA(t *testing.T) {
+	dir := t.TempDir()
+	publicPath := filepath.Join(dir, "public.pem")
+	privatePath := writeFile(t, dir, "private.pem", runCLI(t, "", cli.ExitOK, "keygen", "rsa", "--bits", "1024", "--public-out", publicPath))
+
+	message := strings.Repeat("long message for envelope ", 100)
+	for _, mode := range []string{"envelope", "oaep", "raw"} {
+		for _, encoding := range []string{"hex", "base64", "raw"} {
+			plaintext := message
+			if mode != "envelope" {
+				plaintext = "short message"
+			}
+			encrypted := runCLI(t, plaintext, cli.ExitOK, "encrypt", "--key", publicPath, "--mode", mode, "--output", encoding)
+			decrypted := runCLI(t, encrypted, cli.ExitOK, "decrypt", "--key", privatePath, "--mode", mode, "--input", encoding)
+			if decrypted != plaintext {
+				t.Errorf("Mode %s with %s encoding: expected %q, got %q", mode, encoding, plaintext, decrypted)
+			}
+		}
+	}
+
+	// Public key cannot decrypt, unknown mode is a usage error.
+	encrypted := runCLI(t, "secret", cli.ExitOK, "encrypt", "--key", publicPath)
+	runCLI(t, encrypted, cli.ExitFailure, "decrypt", "--key", publicPath)
+	runCLI(t, "secret", cli.ExitUsage, "encrypt", "--key", publicPath, "--mode", "gcm")
+
+	// Signatures in both schemes, files as input.
+	messagePath := writeFile(t, dir, "message.txt", "signed message")
+	for _, scheme := range []string{"pss", "pkcs1v15"} {
+		signaturePath := writeFile(t, dir, "signature", runCLI(t, "", cli.ExitOK, "sign", "--key", privatePath, "--in", messagePath, "--scheme", scheme))
+		if output := runCLI(t, "", cli.ExitOK, "verify", "--key", publicPath, "--in", messagePath, "--signature", signaturePath, "--scheme", scheme); output != "OK\n" {
+			t.Errorf("Expected OK, got %q", output)
+		}
+		runCLI(t, "other message", cli.ExitFailure, "verify", "--key", publicPath, "--signature", signaturePath, "--scheme", scheme)
+	}
+	runCLI(t, "message", cli.ExitFailure, "sign", "--key", publicPath)
+}
+
+func TestCLIAES(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, bits := range []string{"128", "192", "256"} {
+		keyPath := writeFile(t, dir, "key"+bits, runCLI(t, "", cli.ExitOK, "keygen", "aes", "--bits", bits, "--output", "base64"))
+
+		for _, mode := range []string{"gcm", "cbc", "ecb"} {
+			plaintext := "message of any length"
+			encrypted := runCLI(t, plaintext, cli.ExitOK, "encrypt", "--key", keyPath, "--key-encoding", "base64", "--mode", mode)
+			decrypted := runCLI(t, encrypted, cli.ExitOK, "decrypt", "--key", keyPath, "--key-encoding", "base64", "--mode", mode)
+			if decrypted != plaintext {
+				t.Errorf("AES-%s %s: expected %q, got %q", bits, mode, plaintext, decrypted)
+			}
+		}
+	}
+
+	keyPath := writeFile(t, dir, "key", runCLI(t, "", cli.ExitOK, "keygen", "aes"))
+	encrypted := []byte(strings.TrimSpace(runCLI(t, "data", cli.ExitOK, "encrypt", "--key", keyPath)))
+	encrypted[len(encrypted)-1] ^= 1
+	runCLI(t, string(encrypted), cli.ExitFailure, "decrypt", "--key", keyPath)
+	runCLI(t, "not hex", cli.ExitFailure, "decrypt", "--key", keyPath)
+	runCLI(t, "", cli.ExitFailure, "keygen", "aes", "--bits", "100")
+}
+
+func TestCLIJSON(t *testing.T) {
+	dir := t.TempDir()
+	publicPath := filepath.Join(dir, "public.pem")
+	privatePath := writeFile(t, dir, "private.pem", runCLI(t, "", cli.ExitOK, "keygen", "rsa", "--bits", "1024", "--public-out", publicPath))
+
+	document := `{"name":"Alice","ssn":"078-05-1120"}`
+	cases := [][]string{
+		{},
+		{"--select", "$.ssn"},
+		{"--encrypt-keys"},
+	}
+	for _, flags := range cases {
+		encrypted := runCLI(t, document, cli.ExitOK, append([]string{"encrypt-json", "--key", publicPath}, flags...)...)
+		if strings.Contains(encrypted, "078-05-1120") {
+			t.Errorf("Flags %v: encrypted document leaks value: %s", flags, encrypted)
+		}
+		if decrypted := runCLI(t, encrypted, cli.ExitOK, "decrypt-json", "--key", privatePath); decrypted != document+"\n" {
+			t.Errorf("Flags %v: expected %s, got %s", flags, document, decrypted)
+		}
+	}
+
+	runCLI(t, document, cli.ExitUsage, "encrypt-json", "--key", publicPath, "--select", "$.ssn", "--encrypt-keys")
+	runCLI(t, "{", cli.ExitFailure, "encrypt-json", "--key", publicPath)
+}
+
+func TestCLIUsage(t *testing.T) {
+	runCLI(t, "", cli.ExitUsage)
+	runCLI(t, "", cli.ExitUsage, "unknown")
+	runCLI(t, "", cli.ExitUsage, "keygen", "dsa")
+	runCLI(t, "", cli.ExitUsage, "encrypt", "--no-such-flag")
+	runCLI(t, "", cli.ExitUsage, "encrypt")
+	runCLI(t, "", cli.ExitOK, "help")
+	runCLI(t, "", cli.ExitOK, "encrypt", "--help")
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/mesiriak/cyphering/pkg/envelope"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	// Messages much larger than N are fine, only the AES key is encrypted with RSA.
+	for _, size := range []int{0, 1, 1000, 1 << 20} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		sealed, err := envelope.Seal(rand.Reader, plaintext, keys.PublicKey, keys.N)
+		if err != nil {
+			t.Fatalf("Seal of %d bytes failed: %v", size, err)
+		}
+		opened, err := envelope.Open(rand.Reader, sealed, keys)
+		if err != nil {
+			t.Fatalf("Open of %d bytes failed: %v", size, err)
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Errorf("Envelope round-trip of %d bytes failed", size)
+		}
+	}
+
+	// Smallest allowed modulus falls back to AES-128.
+	smallKeys, err := rsa.GenerateKeys(envelope.MinKeySize)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	sealed, err := envelope.Seal(nil, []byte("small key"), smallKeys.PublicKey, smallKeys.N)
+	if err != nil {
+		t.Fatalf("Seal with small key failed: %v", err)
+	}
+	if opened, err := envelope.Open(nil, sealed, smallKeys); err != nil || string(opened) != "small key" {
+		t.Errorf("Envelope round-trip with small key failed: %q, %v", opened, err)
+	}
+
+	for _, bitSize := range []int{32, 64, envelope.MinKeySize - 1} {
+		tinyKeys, err := rsa.GenerateKeys(bitSize)
+		if err != nil {
+			t.Fatalf("Failed to generate keys: %v", err)
+		}
+		if _, err := envelope.Seal(nil, []byte("tiny key"), tinyKeys.PublicKey, tinyKeys.N); err == nil {
+			t.Errorf("Expected error for %d bit modulus too small to wrap a key", bitSize)
+		}
+	}
+}
+
+func TestEnvelopeRejectsTampering(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	otherKeys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	sealed, err := envelope.Seal(nil, []byte("authenticated payload"), keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+
+	// Every byte of the envelope is covered: header, wrapped key, nonce, ciphertext and tag.
+	for i := range sealed {
+		tampered := append([]byte(nil), sealed...)
+		tampered[i] ^= 0x01
+		if _, err := envelope.Open(nil, tampered, keys); err == nil {
+			t.Fatalf("Expected error for flipped byte %d", i)
+		}
+	}
+
+	if _, err := envelope.Open(nil, sealed[:len(sealed)-1], keys); err == nil {
+		t.Error("Expected error for truncated envelope")
+	}
+	if _, err := envelope.Open(nil, sealed, otherKeys); err == nil {
+		t.Error("Expected error for wrong private key")
+	}
+}
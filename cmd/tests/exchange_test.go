@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/mesiriak/cyphering/pkg/envelope"
+	"github.com/mesiriak/cyphering/pkg/exchange"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Starts server on a random local port and returns its address.
+func startExchangeServer(t *testing.T, handler exchange.Handler) string {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate server keys: %v", err)
+	}
+
+	server, err := exchange.NewServer(keys, handler)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go server.Serve(listener)
+
+	return listener.Addr().String()
+}
+
+func TestExchangeRoundTrip(t *testing.T) {
+	address := startExchangeServer(t, func(format, body string) (string, error) {
+		if format == exchange.FormatRaw {
+			return strings.ToUpper(body), nil
+		}
+		return body, nil
+	})
+
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate client keys: %v", err)
+	}
+
+	var traffic []string
+	client, err := exchange.Dial(address, keys, func(direction, line string) {
+		traffic = append(traffic, direction+" "+line)
+	})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+
+	if client.ServerKeys().PublicKey == nil || client.ServerKeys().PrivateKey != nil {
+		t.Error("Expected client to know only the server public key")
+	}
+
+	response, err := client.SendRaw("hello server")
+	if err != nil {
+		t.Fatalf("SendRaw failed: %v", err)
+	}
+	if response != "HELLO SERVER" {
+		t.Errorf("Expected HELLO SERVER, got %q", response)
+	}
+
+	document := `{"count":12345678901234567890,"user":{"name":"Alice"}}`
+	response, err = client.SendJSON(document)
+	if err != nil {
+		t.Fatalf("SendJSON failed: %v", err)
+	}
+	if response != document {
+		t.Errorf("Expected %s, got %s", document, response)
+	}
+
+	// Raw payloads are envelopes, so text longer than the modulus is fine.
+	long := strings.Repeat("long message ", 1000)
+	response, err = client.SendRaw(long)
+	if err != nil {
+		t.Fatalf("SendRaw of long text failed: %v", err)
+	}
+	if response != strings.ToUpper(long) {
+		t.Error("Long raw message did not round-trip")
+	}
+
+	// Two key messages, then a request and a response for each send.
+	if len(traffic) != 8 {
+		t.Fatalf("Expected 8 traced lines, got %d: %v", len(traffic), traffic)
+	}
+	for _, line := range traffic[2:] {
+		if strings.Contains(line, "hello") || strings.Contains(line, "HELLO") || strings.Contains(line, "Alice") {
+			t.Errorf("Traffic leaks plaintext: %s", line)
+		}
+	}
+
+	// Raw response is an envelope for the client keys, the format the GUI decrypts.
+	var message exchange.Message
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(traffic[3], "<- ")), &message); err != nil {
+		t.Fatalf("Failed to decode traced response: %v", err)
+	}
+	var payload string
+	if err := json.Unmarshal(message.Payload, &payload); err != nil {
+		t.Fatalf("Failed to decode raw payload: %v", err)
+	}
+	sealed, err := hex.DecodeString(payload)
+	if err != nil {
+		t.Fatalf("Raw payload is not hex: %v", err)
+	}
+	if opened, err := envelope.Open(nil, sealed, keys); err != nil || string(opened) != "HELLO SERVER" {
+		t.Errorf("Expected raw response to open as envelope, got %q, %v", opened, err)
+	}
+}
+
+func TestExchangeErrors(t *testing.T) {
+	address := startExchangeServer(t, func(format, body string) (string, error) {
+		return "", errors.New("handler refused")
+	})
+
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate client keys: %v", err)
+	}
+
+	client, err := exchange.Dial(address, keys, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.SendRaw("anything"); err == nil || !strings.Contains(err.Error(), "handler refused") {
+		t.Errorf("Expected handler error, got %v", err)
+	}
+	// Connection stays usable after an error response.
+	if _, err := client.SendJSON("not json"); err == nil {
+		t.Error("Expected error for invalid JSON request")
+	}
+	if _, err := client.SendRaw("again"); err == nil || !strings.Contains(err.Error(), "handler refused") {
+		t.Errorf("Expected handler error, got %v", err)
+	}
+
+	// Server rejects handshake with invalid public key.
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(`{"type":"public_key","public_key":"65537","n":"7"}` + "\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	reply := make([]byte, 256)
+	n, _ := conn.Read(reply)
+	if !strings.Contains(string(reply[:n]), `"type":"error"`) {
+		t.Errorf("Expected error reply, got %s", reply[:n])
+	}
+
+	if _, err := exchange.NewServer(&rsa.Keys{}, nil); err == nil {
+		t.Error("Expected error for incomplete server keys")
+	}
+}
+
+func TestExchangeRejectsWeakKeys(t *testing.T) {
+	address := startExchangeServer(t, nil)
+
+	smallKeys, err := rsa.GenerateKeys(512)
+	if err != nil {
+		t.Fatalf("Failed to generate client keys: %v", err)
+	}
+	if _, err := exchange.Dial(address, smallKeys, nil); err == nil || !strings.Contains(err.Error(), "too small") {
+		t.Errorf("Expected error for undersized client keys, got %v", err)
+	}
+	if _, err := exchange.NewServer(smallKeys, nil); err == nil {
+		t.Error("Expected error for undersized server keys")
+	}
+
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate client keys: %v", err)
+	}
+	evenN := new(big.Int).Add(keys.N, big.NewInt(1))
+
+	// Server reports why it rejects keys, so clients which skip the check see the reason.
+	handshakes := map[string]string{
+		"undersized modulus": `{"type":"public_key","public_key":"65537","n":"` + smallKeys.N.String() + `"}`,
+		"even exponent":      `{"type":"public_key","public_key":"65536","n":"` + keys.N.String() + `"}`,
+		"exponent one":       `{"type":"public_key","public_key":"1","n":"` + keys.N.String() + `"}`,
+		"even modulus":       `{"type":"public_key","public_key":"65537","n":"` + evenN.String() + `"}`,
+	}
+	for name, handshake := range handshakes {
+		t.Run(name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", address)
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			defer conn.Close()
+			if _, err := conn.Write([]byte(handshake + "\n")); err != nil {
+				t.Fatalf("Failed to write: %v", err)
+			}
+			reply, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read reply: %v", err)
+			}
+			if !strings.Contains(reply, `"type":"error"`) {
+				t.Errorf("Expected error reply, got %s", reply)
+			}
+			if name == "undersized modulus" && !strings.Contains(reply, "too small") {
+				t.Errorf("Expected reply to explain the key is too small, got %s", reply)
+			}
+		})
+	}
+}
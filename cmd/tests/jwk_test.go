@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mesiriak/cyphering/pkg/aes"
+	"github.com/mesiriak/cyphering/pkg/jwk"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"testing"
+)
+
+func TestJWKRSARoundTrip(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	key, err := jwk.FromRSAKeys(keys, "client")
+	if err != nil {
+		t.Fatalf("FromRSAKeys failed: %v", err)
+	}
+	if key.E != "AQAB" {
+		t.Errorf("Expected exponent 65537 to be encoded as AQAB, got %s", key.E)
+	}
+
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK: %v", err)
+	}
+	decoded, err := jwk.ParseKey(encoded)
+	if err != nil {
+		t.Fatalf("ParseKey failed: %v", err)
+	}
+	restored, err := decoded.RSAKeys()
+	if err != nil {
+		t.Fatalf("RSAKeys failed: %v", err)
+	}
+
+	for name, values := range map[string][2]string{
+		"n":  {keys.N.String(), restored.N.String()},
+		"e":  {keys.PublicKey.String(), restored.PublicKey.String()},
+		"d":  {keys.PrivateKey.String(), restored.PrivateKey.String()},
+		"p":  {keys.P.String(), restored.P.String()},
+		"q":  {keys.Q.String(), restored.Q.String()},
+		"dp": {keys.DP.String(), restored.DP.String()},
+		"dq": {keys.DQ.String(), restored.DQ.String()},
+		"qi": {keys.QInv.String(), restored.QInv.String()},
+	} {
+		if values[0] != values[1] {
+			t.Errorf("JWK member %s does not round-trip", name)
+		}
+	}
+
+	public, err := key.Public()
+	if err != nil {
+		t.Fatalf("Public failed: %v", err)
+	}
+	publicKeys, err := public.RSAKeys()
+	if err != nil {
+		t.Fatalf("RSAKeys of public JWK failed: %v", err)
+	}
+	if publicKeys.PrivateKey != nil || publicKeys.N.Cmp(keys.N) != 0 {
+		t.Error("Public JWK must contain only public members")
+	}
+
+	tampered := key
+	tampered.D = key.DP
+	if _, err := tampered.RSAKeys(); err == nil {
+		t.Error("Expected error for inconsistent private key")
+	}
+	tampered = key
+	tampered.N = "not base64url!"
+	if _, err := tampered.RSAKeys(); err == nil {
+		t.Error("Expected error for malformed member")
+	}
+}
+
+func TestJWKAESRoundTrip(t *testing.T) {
+	for _, keySize := range []int{128, 192, 256} {
+		key, err := aes.GenerateRandomKey(keySize)
+		if err != nil {
+			t.Fatalf("GenerateRandomKey failed: %v", err)
+		}
+
+		octKey, err := jwk.FromAESKey(key, "session")
+		if err != nil {
+			t.Fatalf("FromAESKey failed: %v", err)
+		}
+		encoded, err := json.Marshal(octKey)
+		if err != nil {
+			t.Fatalf("Failed to marshal JWK: %v", err)
+		}
+		decoded, err := jwk.ParseKey(encoded)
+		if err != nil {
+			t.Fatalf("ParseKey failed: %v", err)
+		}
+		restored, err := decoded.AESKey()
+		if err != nil {
+			t.Fatalf("AESKey failed: %v", err)
+		}
+		if !bytes.Equal(restored, key) {
+			t.Errorf("AES-%d key does not round-trip: got %x, expected %x", keySize, restored, key)
+		}
+		if _, err := decoded.RSAKeys(); err == nil {
+			t.Error("Expected error for converting oct JWK to RSA keys")
+		}
+	}
+}
+
+func TestJWKSetLookup(t *testing.T) {
+	keys, err := rsa.GenerateKeys(512)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	aesKey, err := aes.GenerateRandomKey(256)
+	if err != nil {
+		t.Fatalf("GenerateRandomKey failed: %v", err)
+	}
+
+	rsaJWK, err := jwk.FromRSAKeys(keys, "server-rsa")
+	if err != nil {
+		t.Fatalf("FromRSAKeys failed: %v", err)
+	}
+	aesJWK, err := jwk.FromAESKey(aesKey, "server-aes")
+	if err != nil {
+		t.Fatalf("FromAESKey failed: %v", err)
+	}
+
+	set := &jwk.Set{}
+	for _, key := range []jwk.Key{rsaJWK, aesJWK} {
+		if err := set.Add(key); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := set.Add(aesJWK); err == nil {
+		t.Error("Expected error for duplicated kid")
+	}
+
+	encoded, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK Set: %v", err)
+	}
+	decoded, err := jwk.ParseSet(encoded)
+	if err != nil {
+		t.Fatalf("ParseSet failed: %v", err)
+	}
+
+	found, err := decoded.Lookup("server-aes")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	restored, err := found.AESKey()
+	if err != nil {
+		t.Fatalf("AESKey failed: %v", err)
+	}
+	if !bytes.Equal(restored, aesKey) {
+		t.Error("AES key from JWK Set does not match")
+	}
+
+	if _, err := decoded.Lookup("unknown"); err == nil {
+		t.Error("Expected error for unknown kid")
+	}
+	if _, err := jwk.ParseSet([]byte(`{"keys":[{"kid":"no type"}]}`)); err == nil {
+		t.Error("Expected error for key without kty")
+	}
+}
@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	stdrsa "crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestPrivateKeyEncodingInteroperability(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	pkcs1, err := rsa.MarshalPKCS1PrivateKey(keys)
+	if err != nil {
+		t.Fatalf("MarshalPKCS1PrivateKey failed: %v", err)
+	}
+	stdKey, err := x509.ParsePKCS1PrivateKey(pkcs1)
+	if err != nil {
+		t.Fatalf("crypto/x509.ParsePKCS1PrivateKey failed: %v", err)
+	}
+	if stdKey.N.Cmp(keys.N) != 0 || stdKey.D.Cmp(keys.PrivateKey) != 0 || int64(stdKey.E) != keys.PublicKey.Int64() {
+		t.Error("PKCS#1 private key parsed by crypto/x509 does not match")
+	}
+
+	pkcs8, err := rsa.MarshalPKCS8PrivateKey(keys)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey failed: %v", err)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(pkcs8)
+	if err != nil {
+		t.Fatalf("crypto/x509.ParsePKCS8PrivateKey failed: %v", err)
+	}
+	if !parsed.(*stdrsa.PrivateKey).Equal(stdKey) {
+		t.Error("PKCS#8 private key parsed by crypto/x509 does not match")
+	}
+
+	// Keys produced by crypto/x509 must be parsed back.
+	stdPKCS8, err := x509.MarshalPKCS8PrivateKey(stdKey)
+	if err != nil {
+		t.Fatalf("crypto/x509.MarshalPKCS8PrivateKey failed: %v", err)
+	}
+	for name, decode := range map[string]func() (*rsa.Keys, error){
+		"PKCS#1": func() (*rsa.Keys, error) { return rsa.ParsePKCS1PrivateKey(x509.MarshalPKCS1PrivateKey(stdKey)) },
+		"PKCS#8": func() (*rsa.Keys, error) { return rsa.ParsePKCS8PrivateKey(stdPKCS8) },
+	} {
+		decoded, err := decode()
+		if err != nil {
+			t.Fatalf("%s parsing failed: %v", name, err)
+		}
+		if decoded.N.Cmp(keys.N) != 0 || decoded.PrivateKey.Cmp(keys.PrivateKey) != 0 || decoded.QInv.Cmp(keys.QInv) != 0 {
+			t.Errorf("%s parsed keys do not match", name)
+		}
+	}
+
+	for _, pemType := range []string{rsa.PKCS1PrivateKeyPEMType, rsa.PKCS8PrivateKeyPEMType} {
+		encoded, err := rsa.MarshalPrivateKeyPEM(keys, pemType)
+		if err != nil {
+			t.Fatalf("MarshalPrivateKeyPEM failed: %v", err)
+		}
+		if block, _ := pem.Decode(encoded); block == nil || block.Type != pemType {
+			t.Errorf("Expected PEM block of type %s", pemType)
+		}
+		decoded, err := rsa.ParsePEM(encoded)
+		if err != nil {
+			t.Fatalf("ParsePEM failed: %v", err)
+		}
+		if decoded.PrivateKey.Cmp(keys.PrivateKey) != 0 {
+			t.Errorf("%s PEM round-trip does not match", pemType)
+		}
+	}
+}
+
+func TestPublicKeyEncodingInteroperability(t *testing.T) {
+	stdKey, err := stdrsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate standard library key: %v", err)
+	}
+	publicKey, N := big.NewInt(int64(stdKey.E)), stdKey.N
+
+	pkix, err := rsa.MarshalPKIXPublicKey(publicKey, N)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(pkix)
+	if err != nil {
+		t.Fatalf("crypto/x509.ParsePKIXPublicKey failed: %v", err)
+	}
+	if !parsed.(*stdrsa.PublicKey).Equal(&stdKey.PublicKey) {
+		t.Error("SubjectPublicKeyInfo parsed by crypto/x509 does not match")
+	}
+
+	stdPKIX, err := x509.MarshalPKIXPublicKey(&stdKey.PublicKey)
+	if err != nil {
+		t.Fatalf("crypto/x509.MarshalPKIXPublicKey failed: %v", err)
+	}
+	decoded, err := rsa.ParsePKIXPublicKey(stdPKIX)
+	if err != nil {
+		t.Fatalf("ParsePKIXPublicKey failed: %v", err)
+	}
+	if decoded.N.Cmp(N) != 0 || decoded.PublicKey.Cmp(publicKey) != 0 || decoded.PrivateKey != nil {
+		t.Error("SubjectPublicKeyInfo parsed keys do not match")
+	}
+
+	decoded, err = rsa.ParsePKCS1PublicKey(x509.MarshalPKCS1PublicKey(&stdKey.PublicKey))
+	if err != nil {
+		t.Fatalf("ParsePKCS1PublicKey failed: %v", err)
+	}
+	if decoded.N.Cmp(N) != 0 || decoded.PublicKey.Cmp(publicKey) != 0 {
+		t.Error("PKCS#1 public key parsed keys do not match")
+	}
+
+	encoded, err := rsa.MarshalPublicKeyPEM(publicKey, N, rsa.PKCS1PublicKeyPEMType)
+	if err != nil {
+		t.Fatalf("MarshalPublicKeyPEM failed: %v", err)
+	}
+	block, _ := pem.Decode(encoded)
+	if _, err := x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+		t.Errorf("crypto/x509.ParsePKCS1PublicKey failed on PEM content: %v", err)
+	}
+}
+
+func TestKeyEncodingRejectsMalformed(t *testing.T) {
+	keys, err := rsa.GenerateKeys(512)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	pkcs1, err := rsa.MarshalPKCS1PrivateKey(keys)
+	if err != nil {
+		t.Fatalf("MarshalPKCS1PrivateKey failed: %v", err)
+	}
+	pkix, err := rsa.MarshalPKIXPublicKey(keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	// PKCS#8 of an ECDSA key, algorithm is not rsaEncryption.
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	ecdsaPKCS8, err := x509.MarshalPKCS8PrivateKey(ecdsaKey)
+	if err != nil {
+		t.Fatalf("crypto/x509.MarshalPKCS8PrivateKey failed: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		parse    func([]byte) (*rsa.Keys, error)
+		der      []byte
+		contains string
+	}{
+		{"Truncated PKCS#1", rsa.ParsePKCS1PrivateKey, pkcs1[:len(pkcs1)-10], "malformed ASN.1"},
+		{"Trailing data", rsa.ParsePKCS1PrivateKey, append(append([]byte(nil), pkcs1...), 0x00), "trailing data"},
+		{"Public key as private", rsa.ParsePKCS1PrivateKey, pkix, "malformed ASN.1"},
+		{"Empty input", rsa.ParsePKIXPublicKey, nil, "malformed ASN.1"},
+		{"Other algorithm", rsa.ParsePKCS8PrivateKey, ecdsaPKCS8, "unsupported algorithm"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.parse(tc.der)
+			if err == nil {
+				t.Fatal("Expected parsing error")
+			}
+			if !strings.Contains(err.Error(), tc.contains) {
+				t.Errorf("Expected error to mention %q, got %v", tc.contains, err)
+			}
+		})
+	}
+
+	// Structurally valid key with broken invariants.
+	broken := *keys
+	broken.PrivateKey = new(big.Int).Add(keys.PrivateKey, big.NewInt(2))
+	brokenDER := x509.MarshalPKCS1PrivateKey(&stdrsa.PrivateKey{
+		PublicKey: stdrsa.PublicKey{N: broken.N, E: int(broken.PublicKey.Int64())},
+		D:         broken.PrivateKey,
+		Primes:    []*big.Int{broken.P, broken.Q},
+	})
+	if _, err := rsa.ParsePKCS1PrivateKey(brokenDER); err == nil {
+		t.Error("Expected error for inconsistent private key")
+	}
+
+	if _, err := rsa.ParsePEM([]byte("not a PEM")); err == nil {
+		t.Error("Expected error for missing PEM block")
+	}
+	if _, err := rsa.ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pkcs1})); err == nil {
+		t.Error("Expected error for unsupported PEM block type")
+	}
+	if _, err := rsa.MarshalPKCS1PrivateKey(&rsa.Keys{PublicKey: keys.PublicKey, PrivateKey: keys.PrivateKey, N: keys.N}); err == nil {
+		t.Error("Expected error for private key without primes")
+	}
+}
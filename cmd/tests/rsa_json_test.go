@@ -0,0 +1,417 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"strings"
+	"testing"
+)
+
+// Decodes JSON keeping numbers as written.
+func decodeJSON(t *testing.T, document string) interface{} {
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return value
+}
+
+// Marshals value, map keys are sorted so documents can be compared.
+func encodeJSON(t *testing.T, value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to encode JSON: %v", err)
+	}
+	return string(encoded)
+}
+
+func TestEncryptStructPreservesTypes(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	// Object keys are sorted, because decoded objects are marshalled in key order.
+	documents := []string{
+		`"plain string"`,
+		`42`,
+		`-0.5`,
+		`12345678901234567890`,
+		`1e+21`,
+		`true`,
+		`null`,
+		`[]`,
+		`{}`,
+		`{"admin":false,"age":30,"manager":null,"name":"Alice","scores":[1.5,2,{"nested":[true,"x"]}]}`,
+		`{"$encrypted":"not really","$type":"string"}`,
+		`{"$encrypted":"not really"}`,
+	}
+
+	for _, document := range documents {
+		t.Run(document, func(t *testing.T) {
+			encrypted, err := rsa.EncryptStruct(decodeJSON(t, document), keys.PublicKey, keys.N)
+			if err != nil {
+				t.Fatalf("EncryptStruct failed: %v", err)
+			}
+
+			// Encrypted document goes through JSON, like it does between client and server.
+			transferred := decodeJSON(t, encodeJSON(t, encrypted))
+
+			decrypted, err := rsa.DecryptStruct(transferred, keys)
+			if err != nil {
+				t.Fatalf("DecryptStruct failed: %v", err)
+			}
+			if result := encodeJSON(t, decrypted); result != document {
+				t.Errorf("Expected decrypted document to be %s, got %s", document, result)
+			}
+		})
+	}
+}
+
+func TestEncryptStructHidesValues(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	encrypted, err := rsa.EncryptStruct(decodeJSON(t, `{"secret":"hunter2","pin":1234,"flag":true}`), keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptStruct failed: %v", err)
+	}
+	encoded := encodeJSON(t, encrypted)
+	// Values are checked with their neighbours, because short values may appear inside hex by chance.
+	for _, leaked := range []string{"hunter2", ":1234", ":true"} {
+		if strings.Contains(encoded, leaked) {
+			t.Errorf("Encrypted document leaks %s: %s", leaked, encoded)
+		}
+	}
+
+	// Types are not recorded in clear and OAEP is randomized, so equal values get different ciphertexts.
+	if strings.Contains(encoded, "$type") {
+		t.Errorf("Encrypted document records value types: %s", encoded)
+	}
+	first, err := rsa.EncryptStruct(true, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptStruct failed: %v", err)
+	}
+	second, err := rsa.EncryptStruct(true, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptStruct failed: %v", err)
+	}
+	if encodeJSON(t, first) == encodeJSON(t, second) {
+		t.Error("Expected equal values to be encrypted to different ciphertexts")
+	}
+
+	// Unencrypted and tampered values are rejected.
+	if _, err := rsa.DecryptStruct(decodeJSON(t, `{"plain":"value"}`), keys); err == nil {
+		t.Error("Expected error for unencrypted value")
+	}
+	object := encrypted.(map[string]interface{})["pin"].(map[string]interface{})
+	object["$encrypted"] = object["$encrypted"].(string)[:len(object["$encrypted"].(string))-2] + "00"
+	if _, err := rsa.DecryptStruct(encrypted, keys); err == nil {
+		t.Error("Expected error for tampered value")
+	}
+
+	if _, err := rsa.EncryptStruct(bytes.NewBuffer(nil), keys.PublicKey, keys.N); err == nil {
+		t.Error("Expected error for unsupported type")
+	}
+}
+
+func TestEncryptStructLongValues(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	// 62 bytes fit OAEP with 1024-bit keys, longer encodings are encrypted with AES-GCM.
+	for _, length := range []int{60, 61, 200, 5000} {
+		value := strings.Repeat("v", length)
+
+		encrypted, err := rsa.EncryptStruct(value, keys.PublicKey, keys.N)
+		if err != nil {
+			t.Fatalf("EncryptStruct of %d characters failed: %v", length, err)
+		}
+		decrypted, err := rsa.DecryptStruct(decodeJSON(t, encodeJSON(t, encrypted)), keys)
+		if err != nil {
+			t.Fatalf("DecryptStruct of %d characters failed: %v", length, err)
+		}
+		if decrypted != value {
+			t.Errorf("Long value of %d characters did not round-trip", length)
+		}
+	}
+
+	encrypted, err := rsa.EncryptStruct(strings.Repeat("v", 200), keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptStruct failed: %v", err)
+	}
+	hexValue := encrypted.(map[string]interface{})["$encrypted"].(string)
+
+	// Wrapped key, nonce, ciphertext and tag are all authenticated.
+	for _, position := range []int{0, 2 * 128, 2*128 + 2*12, len(hexValue) - 2} {
+		tampered := hexValue[:position] + flipHexByte(hexValue[position:position+2]) + hexValue[position+2:]
+		if _, err := rsa.DecryptStruct(map[string]interface{}{"$encrypted": tampered}, keys); err == nil {
+			t.Errorf("Expected error for tampered byte at hex position %d", position)
+		}
+	}
+	if _, err := rsa.DecryptStruct(map[string]interface{}{"$encrypted": hexValue[:2*128+2*12]}, keys); err == nil {
+		t.Error("Expected error for truncated value")
+	}
+
+	// Modulus too small to wrap an AES key is reported.
+	smallKeys, err := rsa.GenerateKeys(512)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	if _, err := rsa.EncryptStruct(true, smallKeys.PublicKey, smallKeys.N); err == nil {
+		t.Error("Expected error for modulus too small to encrypt values")
+	}
+}
+
+// Flips the lowest bit of a hex encoded byte.
+func flipHexByte(byteHex string) string {
+	decoded, _ := hex.DecodeString(byteHex)
+	return hex.EncodeToString([]byte{decoded[0] ^ 0x01})
+}
+
+func TestEncryptFieldsSelectors(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	document := `{"cards":[{"holder":"Alice","number":"4111"},{"holder":"Bob","number":"5500"}],"id":7,"user":{"address":{"city":"Kyiv"},"name":"Alice","ssn":"078-05-1120"}}`
+	original := decodeJSON(t, document)
+
+	encrypted, err := rsa.EncryptFields(original, []string{"$.user.ssn", "$.cards[*].number", "$.user.address", "$.missing.field"}, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptFields failed: %v", err)
+	}
+	if encodeJSON(t, original) != document {
+		t.Error("EncryptFields modified its input")
+	}
+
+	encoded := encodeJSON(t, encrypted)
+	for _, leaked := range []string{"078-05-1120", `"4111"`, `"5500"`, "Kyiv", "city"} {
+		if strings.Contains(encoded, leaked) {
+			t.Errorf("Encrypted document leaks %s: %s", leaked, encoded)
+		}
+	}
+	for _, readable := range []string{`"holder":"Alice"`, `"holder":"Bob"`, `"id":7`, `"name":"Alice"`} {
+		if !strings.Contains(encoded, readable) {
+			t.Errorf("Expected %s to stay readable: %s", readable, encoded)
+		}
+	}
+
+	decrypted, err := rsa.DecryptFields(decodeJSON(t, encoded), keys)
+	if err != nil {
+		t.Fatalf("DecryptFields failed: %v", err)
+	}
+	if result := encodeJSON(t, decrypted); result != document {
+		t.Errorf("Expected decrypted document to be %s, got %s", document, result)
+	}
+
+	// Fully encrypted document is decrypted by DecryptFields as well.
+	full, err := rsa.EncryptStruct(original, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptStruct failed: %v", err)
+	}
+	decrypted, err = rsa.DecryptFields(full, keys)
+	if err != nil {
+		t.Fatalf("DecryptFields failed: %v", err)
+	}
+	if result := encodeJSON(t, decrypted); result != document {
+		t.Errorf("Expected decrypted document to be %s, got %s", document, result)
+	}
+}
+
+func TestEncryptedMarkersDoNotCollideWithData(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	// Keys shaped like markers, escapes and a user object shaped like an encrypted value.
+	document := `{"$":"dollar","$$y":"escaped","$encrypted":"00","$key:00":"token","marker":{"$encrypted":"00"},"secret":"hunter2"}`
+
+	// EncryptFields leaves plain values, so only DecryptFields accepts its output.
+	cases := []struct {
+		name    string
+		encrypt func(interface{}) (interface{}, error)
+		decrypt func(interface{}, *rsa.Keys) (interface{}, error)
+	}{
+		{"EncryptStruct", func(json interface{}) (interface{}, error) {
+			return rsa.EncryptStruct(json, keys.PublicKey, keys.N)
+		}, rsa.DecryptStruct},
+		{"EncryptStructWithKeys", func(json interface{}) (interface{}, error) {
+			return rsa.EncryptStructWithKeys(json, keys.PublicKey, keys.N)
+		}, rsa.DecryptStruct},
+		{"EncryptFields", func(json interface{}) (interface{}, error) {
+			return rsa.EncryptFields(json, []string{"$.secret"}, keys.PublicKey, keys.N)
+		}, rsa.DecryptFields},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			encrypted, err := c.encrypt(decodeJSON(t, document))
+			if err != nil {
+				t.Fatalf("Encryption failed: %v", err)
+			}
+			encoded := encodeJSON(t, encrypted)
+
+			decrypted, err := c.decrypt(decodeJSON(t, encoded), keys)
+			if err != nil {
+				t.Fatalf("Decryption of %s failed: %v", encoded, err)
+			}
+			if result := encodeJSON(t, decrypted); result != document {
+				t.Errorf("Expected decrypted document to be %s, got %s", document, result)
+			}
+		})
+	}
+
+	// Unescaped reserved key cannot come from encryption.
+	if _, err := rsa.DecryptFields(decodeJSON(t, `{"$schema":"plain"}`), keys); err == nil {
+		t.Error("Expected error for unescaped reserved key")
+	}
+}
+
+func TestEncryptFieldsLargeSubtrees(t *testing.T) {
+	keys, err := rsa.GenerateKeys(2048)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	// Both the user object and each card are longer than the 190 bytes OAEP fits with 2048-bit keys.
+	document := `{"cards":[` +
+		`{"billing":{"city":"Kyiv","street":"Khreshchatyk St, 22, apt. 15","zip":"01001"},"cvv":"123","expires":"12/29","holder":"Alice Example","number":"4111111111111111"},` +
+		`{"billing":{"city":"Lviv","street":"Svobody Ave, 28, apt. 4","zip":"79000"},"cvv":"456","expires":"03/28","holder":"Bob Example","number":"5500005555555559"}` +
+		`],"id":7,"user":{"address":{"city":"Kyiv","country":"Ukraine","street":"Khreshchatyk St, 22, apt. 15","zip":"01001"},` +
+		`"birth_date":"1990-04-12","email":"alice@example.com","name":"Alice Example","phone":"+380 44 123 4567","ssn":"078-05-1120"}}`
+
+	encrypted, err := rsa.EncryptFields(decodeJSON(t, document), []string{"$.user", "$.cards[*]"}, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptFields failed: %v", err)
+	}
+
+	encoded := encodeJSON(t, encrypted)
+	for _, leaked := range []string{"Alice", "Bob", "Kyiv", "078-05-1120", "billing", "email"} {
+		if strings.Contains(encoded, leaked) {
+			t.Errorf("Encrypted document leaks %s: %s", leaked, encoded)
+		}
+	}
+
+	decrypted, err := rsa.DecryptFields(decodeJSON(t, encoded), keys)
+	if err != nil {
+		t.Fatalf("DecryptFields failed: %v", err)
+	}
+	if result := encodeJSON(t, decrypted); result != document {
+		t.Errorf("Expected decrypted document to be %s, got %s", document, result)
+	}
+}
+
+func TestEncryptFieldsIndexAndQuotedKey(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	document := `{"items":["first","second"],"odd key":"secret"}`
+	encrypted, err := rsa.EncryptFields(decodeJSON(t, document), []string{"$.items[1]", "$['odd key']", "$.items[5]"}, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptFields failed: %v", err)
+	}
+
+	object := encrypted.(map[string]interface{})
+	items := object["items"].([]interface{})
+	if items[0] != "first" {
+		t.Errorf("Expected first item to stay readable, got %v", items[0])
+	}
+	if _, ok := items[1].(map[string]interface{}); !ok {
+		t.Errorf("Expected second item to be encrypted, got %v", items[1])
+	}
+	if _, ok := object["odd key"].(map[string]interface{}); !ok {
+		t.Errorf("Expected quoted key to be encrypted, got %v", object["odd key"])
+	}
+}
+
+func TestEncryptFieldsInvalidSelectors(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	for _, selector := range []string{"user.ssn", "$", "$.", "$.cards[", "$.cards[-1]", "$.cards[x]", "$..ssn", "$user"} {
+		if _, err := rsa.EncryptFields(decodeJSON(t, `{}`), []string{selector}, keys.PublicKey, keys.N); err == nil {
+			t.Errorf("Expected error for selector %q", selector)
+		}
+	}
+}
+
+func TestEncryptStructWithKeys(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	document := `{"":"empty","\u0000":"zero byte","diagnosis":"flu","patient":{"password":"hunter2","tags":[{"x":1}]}}`
+	encrypted, err := rsa.EncryptStructWithKeys(decodeJSON(t, document), keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptStructWithKeys failed: %v", err)
+	}
+
+	encoded := encodeJSON(t, encrypted)
+	for _, leaked := range []string{"diagnosis", "patient", "password", "tags", `"x"`} {
+		if strings.Contains(encoded, leaked) {
+			t.Errorf("Encrypted document leaks key %s: %s", leaked, encoded)
+		}
+	}
+
+	// Keys differing only by leading zero bytes get distinct tokens.
+	if count := len(encrypted.(map[string]interface{})); count != 4 {
+		t.Errorf("Expected 4 distinct encrypted keys, got %d", count)
+	}
+
+	// Tokens are randomized, so encrypting a guessed key name never reproduces a token of the document.
+	again, err := rsa.EncryptStructWithKeys(decodeJSON(t, `{"diagnosis":"cold"}`), keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptStructWithKeys failed: %v", err)
+	}
+	for token := range again.(map[string]interface{}) {
+		if _, ok := encrypted.(map[string]interface{})[token]; ok {
+			t.Errorf("Expected token %s not to be reused for the same key", token)
+		}
+	}
+
+	for _, decrypt := range []func(interface{}, *rsa.Keys) (interface{}, error){rsa.DecryptStruct, rsa.DecryptFields} {
+		decrypted, err := decrypt(decodeJSON(t, encoded), keys)
+		if err != nil {
+			t.Fatalf("Decryption failed: %v", err)
+		}
+		if result := encodeJSON(t, decrypted); result != document {
+			t.Errorf("Expected decrypted document to be %s, got %s", document, result)
+		}
+	}
+
+	// Key too long for OAEP is encrypted with AES-GCM.
+	longKey := `{"` + strings.Repeat("k", 200) + `":1}`
+	encrypted, err = rsa.EncryptStructWithKeys(decodeJSON(t, longKey), keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptStructWithKeys of long key failed: %v", err)
+	}
+	decrypted, err := rsa.DecryptStruct(decodeJSON(t, encodeJSON(t, encrypted)), keys)
+	if err != nil {
+		t.Fatalf("Decryption of long key failed: %v", err)
+	}
+	if result := encodeJSON(t, decrypted); result != longKey {
+		t.Errorf("Expected decrypted document to be %s, got %s", longKey, result)
+	}
+
+	// Corrupted token is rejected.
+	if _, err := rsa.DecryptStruct(decodeJSON(t, `{"$key:zz":{"$encrypted":"00"}}`), keys); err == nil {
+		t.Error("Expected error for corrupted key token")
+	}
+}
@@ -1,8 +1,21 @@
 package tests
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	stdrsa "crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"github.com/mesiriak/cyphering/pkg/rsa"
+	"io"
+	"math"
+	"math/big"
+	mathrand "math/rand"
 	"testing"
+	"time"
 )
 
 func TestEncryptDecrypt_VariousMessages(t *testing.T) {
@@ -34,7 +47,7 @@ func TestEncryptDecrypt_VariousMessages(t *testing.T) {
 				t.Fatalf("Encryption failed: %v", err)
 			}
 
-			decrypted, err := rsa.Decrypt(encrypted, keys.PrivateKey, keys.N)
+			decrypted, err := rsa.Decrypt(encrypted, keys)
 			if err != nil {
 				t.Fatalf("Decryption failed: %v", err)
 			}
@@ -45,3 +58,488 @@ func TestEncryptDecrypt_VariousMessages(t *testing.T) {
 		})
 	}
 }
+
+func TestOAEPInteroperability(t *testing.T) {
+	stdKey, err := stdrsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate standard library key: %v", err)
+	}
+	keys := &rsa.Keys{
+		PublicKey:  big.NewInt(int64(stdKey.E)),
+		PrivateKey: stdKey.D,
+		N:          stdKey.N,
+	}
+	message := []byte("OAEP interoperability message")
+	label := []byte("label")
+
+	// Package encryption, standard library decryption.
+	encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, message, label, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptOAEP failed: %v", err)
+	}
+	decrypted, err := stdrsa.DecryptOAEP(sha256.New(), nil, stdKey, encrypted, label)
+	if err != nil {
+		t.Fatalf("crypto/rsa.DecryptOAEP failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, message) {
+		t.Errorf("Expected decrypted message to be %s, got %s", message, decrypted)
+	}
+
+	// Standard library encryption, package decryption, also with SHA-1 as pluggable hash.
+	encrypted, err = stdrsa.EncryptOAEP(sha1.New(), rand.Reader, &stdKey.PublicKey, message, nil)
+	if err != nil {
+		t.Fatalf("crypto/rsa.EncryptOAEP failed: %v", err)
+	}
+	decrypted, err = rsa.DecryptOAEP(sha1.New(), rand.Reader, encrypted, nil, keys)
+	if err != nil {
+		t.Fatalf("DecryptOAEP failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, message) {
+		t.Errorf("Expected decrypted message to be %s, got %s", message, decrypted)
+	}
+}
+
+func TestOAEPRejectsMalformed(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	message := []byte("Hello")
+
+	encrypted, err := rsa.EncryptOAEP(nil, rand.Reader, message, nil, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptOAEP failed: %v", err)
+	}
+	again, err := rsa.EncryptOAEP(nil, rand.Reader, message, nil, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptOAEP failed: %v", err)
+	}
+	if bytes.Equal(encrypted, again) {
+		t.Error("OAEP encryption must be randomized")
+	}
+
+	if _, err := rsa.DecryptOAEP(nil, nil, encrypted, []byte("other label"), keys); err != rsa.ErrDecryption {
+		t.Errorf("Expected decryption error for wrong label, got %v", err)
+	}
+
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)-1] ^= 0x01
+	if _, err := rsa.DecryptOAEP(nil, nil, tampered, nil, keys); err != rsa.ErrDecryption {
+		t.Errorf("Expected decryption error for tampered ciphertext, got %v", err)
+	}
+
+	if _, err := rsa.DecryptOAEP(nil, nil, encrypted[1:], nil, keys); err != rsa.ErrDecryption {
+		t.Errorf("Expected decryption error for short ciphertext, got %v", err)
+	}
+
+	tooLong := make([]byte, len(encrypted))
+	if _, err := rsa.EncryptOAEP(nil, rand.Reader, tooLong, nil, keys.PublicKey, keys.N); err == nil {
+		t.Error("Expected encryption error for too long message")
+	}
+}
+
+func TestPKCS1v15Encryption(t *testing.T) {
+	stdKey, err := stdrsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate standard library key: %v", err)
+	}
+	keys := &rsa.Keys{
+		PublicKey:  big.NewInt(int64(stdKey.E)),
+		PrivateKey: stdKey.D,
+		N:          stdKey.N,
+	}
+	message := []byte("legacy message")
+
+	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, message, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptPKCS1v15 failed: %v", err)
+	}
+	decrypted, err := stdrsa.DecryptPKCS1v15(nil, stdKey, encrypted)
+	if err != nil {
+		t.Fatalf("crypto/rsa.DecryptPKCS1v15 failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, message) {
+		t.Errorf("Expected decrypted message to be %s, got %s", message, decrypted)
+	}
+
+	encrypted, err = stdrsa.EncryptPKCS1v15(rand.Reader, &stdKey.PublicKey, message)
+	if err != nil {
+		t.Fatalf("crypto/rsa.EncryptPKCS1v15 failed: %v", err)
+	}
+	for _, decrypt := range []func(io.Reader, []byte, *rsa.Keys) ([]byte, error){rsa.DecryptPKCS1v15, rsa.DecryptPKCS1v15ImplicitRejection} {
+		decrypted, err = decrypt(rand.Reader, encrypted, keys)
+		if err != nil {
+			t.Fatalf("Decryption failed: %v", err)
+		}
+		if !bytes.Equal(decrypted, message) {
+			t.Errorf("Expected decrypted message to be %s, got %s", message, decrypted)
+		}
+	}
+
+	// Flipped bit in ciphertext breaks the padding structure.
+	invalid, err := stdrsa.EncryptPKCS1v15(rand.Reader, &stdKey.PublicKey, message)
+	if err != nil {
+		t.Fatalf("crypto/rsa.EncryptPKCS1v15 failed: %v", err)
+	}
+	invalid[len(invalid)-1] ^= 0x01
+
+	if _, err := rsa.DecryptPKCS1v15(rand.Reader, invalid, keys); err != rsa.ErrDecryption {
+		t.Errorf("Expected decryption error for invalid padding, got %v", err)
+	}
+
+	first, err := rsa.DecryptPKCS1v15ImplicitRejection(rand.Reader, invalid, keys)
+	if err != nil {
+		t.Fatalf("Implicit rejection must not report padding errors, got %v", err)
+	}
+	second, err := rsa.DecryptPKCS1v15ImplicitRejection(rand.Reader, invalid, keys)
+	if err != nil {
+		t.Fatalf("Implicit rejection must not report padding errors, got %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("Implicit rejection must be deterministic for the same ciphertext")
+	}
+	if bytes.Equal(first, message) {
+		t.Error("Implicit rejection returned the original message for tampered ciphertext")
+	}
+}
+
+func TestSignaturesInteroperability(t *testing.T) {
+	stdKey, err := stdrsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate standard library key: %v", err)
+	}
+	keys := &rsa.Keys{
+		PublicKey:  big.NewInt(int64(stdKey.E)),
+		PrivateKey: stdKey.D,
+		N:          stdKey.N,
+	}
+	hashed := sha256.Sum256([]byte("message from the client"))
+	otherHashed := sha256.Sum256([]byte("message from someone else"))
+
+	t.Run("PKCS1v15", func(t *testing.T) {
+		signature, err := rsa.SignPKCS1v15(rand.Reader, crypto.SHA256, hashed[:], keys)
+		if err != nil {
+			t.Fatalf("SignPKCS1v15 failed: %v", err)
+		}
+		if err := stdrsa.VerifyPKCS1v15(&stdKey.PublicKey, crypto.SHA256, hashed[:], signature); err != nil {
+			t.Errorf("crypto/rsa.VerifyPKCS1v15 rejected signature: %v", err)
+		}
+
+		stdSignature, err := stdrsa.SignPKCS1v15(nil, stdKey, crypto.SHA256, hashed[:])
+		if err != nil {
+			t.Fatalf("crypto/rsa.SignPKCS1v15 failed: %v", err)
+		}
+		if !bytes.Equal(signature, stdSignature) {
+			t.Error("PKCS#1 v1.5 signatures are deterministic and must match")
+		}
+		if err := rsa.VerifyPKCS1v15(crypto.SHA256, hashed[:], stdSignature, keys.PublicKey, keys.N); err != nil {
+			t.Errorf("VerifyPKCS1v15 rejected signature: %v", err)
+		}
+		if err := rsa.VerifyPKCS1v15(crypto.SHA256, otherHashed[:], stdSignature, keys.PublicKey, keys.N); err != rsa.ErrVerification {
+			t.Errorf("Expected verification error for other message, got %v", err)
+		}
+	})
+
+	t.Run("PSS", func(t *testing.T) {
+		for _, saltLength := range []int{rsa.PSSSaltLengthAuto, rsa.PSSSaltLengthEqualsHash, 20} {
+			signature, err := rsa.SignPSS(rand.Reader, crypto.SHA256, hashed[:], saltLength, keys)
+			if err != nil {
+				t.Fatalf("SignPSS failed: %v", err)
+			}
+			options := &stdrsa.PSSOptions{SaltLength: saltLength}
+			if err := stdrsa.VerifyPSS(&stdKey.PublicKey, crypto.SHA256, hashed[:], signature, options); err != nil {
+				t.Errorf("crypto/rsa.VerifyPSS rejected signature with salt length %d: %v", saltLength, err)
+			}
+
+			stdSignature, err := stdrsa.SignPSS(rand.Reader, stdKey, crypto.SHA256, hashed[:], options)
+			if err != nil {
+				t.Fatalf("crypto/rsa.SignPSS failed: %v", err)
+			}
+			if err := rsa.VerifyPSS(crypto.SHA256, hashed[:], stdSignature, saltLength, keys.PublicKey, keys.N); err != nil {
+				t.Errorf("VerifyPSS rejected signature with salt length %d: %v", saltLength, err)
+			}
+			if err := rsa.VerifyPSS(crypto.SHA256, otherHashed[:], stdSignature, saltLength, keys.PublicKey, keys.N); err != rsa.ErrVerification {
+				t.Errorf("Expected verification error for other message, got %v", err)
+			}
+		}
+	})
+}
+
+// Converts standard library key, CRT parameters are kept only when withCRT is set.
+func keysFromStandardKey(t testing.TB, stdKey *stdrsa.PrivateKey, withCRT bool) *rsa.Keys {
+	keys := &rsa.Keys{
+		PublicKey:  big.NewInt(int64(stdKey.E)),
+		PrivateKey: stdKey.D,
+		N:          stdKey.N,
+	}
+	if withCRT {
+		keys.P, keys.Q = stdKey.Primes[0], stdKey.Primes[1]
+		if err := keys.Precompute(); err != nil {
+			t.Fatalf("Precompute failed: %v", err)
+		}
+	}
+	return keys
+}
+
+func TestCRTDecryption(t *testing.T) {
+	keys, err := rsa.GenerateKeys(512)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	if keys.P == nil || keys.Q == nil || keys.DP == nil || keys.DQ == nil || keys.QInv == nil {
+		t.Fatal("GenerateKeys must keep CRT parameters")
+	}
+	withoutCRT := &rsa.Keys{PublicKey: keys.PublicKey, PrivateKey: keys.PrivateKey, N: keys.N}
+
+	for _, message := range []string{"Hello", "CRT", "A message for CRT decryption"} {
+		encrypted, err := rsa.Encrypt(message, keys.PublicKey, keys.N)
+		if err != nil {
+			t.Fatalf("Encryption failed: %v", err)
+		}
+
+		for _, decryptionKeys := range []*rsa.Keys{keys, withoutCRT} {
+			decrypted, err := rsa.DecryptWithKeys(rand.Reader, encrypted, decryptionKeys)
+			if err != nil {
+				t.Fatalf("Decryption failed: %v", err)
+			}
+			if decrypted != message {
+				t.Errorf("Expected decrypted message to be %s, got %s", message, decrypted)
+			}
+		}
+	}
+}
+
+func benchmarkDecryption(b *testing.B, bits int, withCRT bool) {
+	stdKey, err := stdrsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		b.Fatalf("Failed to generate standard library key: %v", err)
+	}
+	keys := keysFromStandardKey(b, stdKey, withCRT)
+
+	encrypted, err := rsa.Encrypt("benchmark message", keys.PublicKey, keys.N)
+	if err != nil {
+		b.Fatalf("Encryption failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rsa.DecryptWithKeys(rand.Reader, encrypted, keys); err != nil {
+			b.Fatalf("Decryption failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkRSADecrypt2048(b *testing.B)    { benchmarkDecryption(b, 2048, false) }
+func BenchmarkRSADecrypt2048CRT(b *testing.B) { benchmarkDecryption(b, 2048, true) }
+func BenchmarkRSADecrypt4096(b *testing.B)    { benchmarkDecryption(b, 4096, false) }
+func BenchmarkRSADecrypt4096CRT(b *testing.B) { benchmarkDecryption(b, 4096, true) }
+
+func TestGenerateKeysModulusSize(t *testing.T) {
+	for _, bitSize := range []int{32, 33, 64, 128, 512, 1024} {
+		keys, err := rsa.GenerateKeys(bitSize)
+		if err != nil {
+			t.Fatalf("Failed to generate %d bit keys: %v", bitSize, err)
+		}
+		if keys.N.BitLen() != bitSize {
+			t.Errorf("Expected %d bit modulus, got %d", bitSize, keys.N.BitLen())
+		}
+		if keys.P.Cmp(keys.Q) == 0 {
+			t.Errorf("Primes of %d bit keys must differ", bitSize)
+		}
+		if err := keys.Validate(); err != nil {
+			t.Errorf("Generated %d bit keys are invalid: %v", bitSize, err)
+		}
+	}
+
+	if _, err := rsa.GenerateKeys(16); err == nil {
+		t.Error("Expected error for too small modulus")
+	}
+}
+
+func TestKeysValidate(t *testing.T) {
+	keys, err := rsa.GenerateKeys(256)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	one := big.NewInt(1)
+
+	testCases := []struct {
+		name   string
+		modify func(keys *rsa.Keys)
+	}{
+		{"Missing N", func(keys *rsa.Keys) { keys.N = nil }},
+		{"Even public key", func(keys *rsa.Keys) { keys.PublicKey = big.NewInt(65536) }},
+		{"Wrong private key", func(keys *rsa.Keys) { keys.PrivateKey = new(big.Int).Add(keys.PrivateKey, one) }},
+		{"Swapped prime", func(keys *rsa.Keys) { keys.Q = new(big.Int).Add(keys.Q, big.NewInt(2)) }},
+		{"Equal primes", func(keys *rsa.Keys) { keys.Q = keys.P }},
+		{"Wrong DP", func(keys *rsa.Keys) { keys.DP = new(big.Int).Add(keys.DP, one) }},
+		{"Wrong QInv", func(keys *rsa.Keys) { keys.QInv = new(big.Int).Add(keys.QInv, one) }},
+		{"Incomplete CRT", func(keys *rsa.Keys) { keys.DQ = nil }},
+		{"Wrong private key without primes", func(keys *rsa.Keys) {
+			keys.P, keys.Q, keys.DP, keys.DQ, keys.QInv = nil, nil, nil, nil, nil
+			keys.PrivateKey = new(big.Int).Add(keys.PrivateKey, one)
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			broken := *keys
+			tc.modify(&broken)
+			if err := broken.Validate(); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+
+	withoutPrimes := &rsa.Keys{PublicKey: keys.PublicKey, PrivateKey: keys.PrivateKey, N: keys.N}
+	if err := withoutPrimes.Validate(); err != nil {
+		t.Errorf("Keys without CRT parameters must be valid: %v", err)
+	}
+}
+
+func TestBlindingUsesInjectedReader(t *testing.T) {
+	keys, err := rsa.GenerateKeys(256)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	encrypted, err := rsa.Encrypt("Hello", keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	// Deterministic reader still gives correct result, blinding is removed after exponentiation.
+	decrypted, err := rsa.DecryptWithKeys(mathrand.New(mathrand.NewSource(1)), encrypted, keys)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if decrypted != "Hello" {
+		t.Errorf("Expected decrypted message to be Hello, got %s", decrypted)
+	}
+
+	if _, err := rsa.DecryptWithKeys(failingReader{}, encrypted, keys); err == nil {
+		t.Error("Expected error when blinding randomness cannot be read")
+	}
+}
+
+func TestPrivateKeyOperationsRequireBlinding(t *testing.T) {
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	encrypted, err := rsa.Encrypt("Hello", keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	// Without public key blinding is impossible, so nothing falls back to unblinded exponentiation.
+	withoutPublicKey := &rsa.Keys{PrivateKey: keys.PrivateKey, N: keys.N, P: keys.P, Q: keys.Q, DP: keys.DP, DQ: keys.DQ, QInv: keys.QInv}
+
+	if _, err := rsa.Decrypt(encrypted, withoutPublicKey); !errors.Is(err, rsa.ErrBlindingImpossible) {
+		t.Errorf("Decrypt: expected ErrBlindingImpossible, got %v", err)
+	}
+	hashed := sha256.Sum256([]byte("message"))
+	oaepEncrypted, err := rsa.EncryptOAEP(nil, rand.Reader, []byte("Hello"), nil, keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptOAEP failed: %v", err)
+	}
+	if _, err := rsa.DecryptOAEP(nil, rand.Reader, oaepEncrypted, nil, withoutPublicKey); !errors.Is(err, rsa.ErrBlindingImpossible) {
+		t.Errorf("DecryptOAEP: expected ErrBlindingImpossible, got %v", err)
+	}
+	pkcs1Encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, []byte("Hello"), keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptPKCS1v15 failed: %v", err)
+	}
+	if _, err := rsa.DecryptPKCS1v15ImplicitRejection(rand.Reader, pkcs1Encrypted, withoutPublicKey); !errors.Is(err, rsa.ErrBlindingImpossible) {
+		t.Errorf("DecryptPKCS1v15ImplicitRejection: expected ErrBlindingImpossible, got %v", err)
+	}
+	if _, err := rsa.SignPSS(rand.Reader, crypto.SHA256, hashed[:], rsa.PSSSaltLengthAuto, withoutPublicKey); !errors.Is(err, rsa.ErrBlindingImpossible) {
+		t.Errorf("SignPSS: expected ErrBlindingImpossible, got %v", err)
+	}
+	encryptedStruct, err := rsa.EncryptStruct("Hello", keys.PublicKey, keys.N)
+	if err != nil {
+		t.Fatalf("EncryptStruct failed: %v", err)
+	}
+	if _, err := rsa.DecryptStruct(encryptedStruct, withoutPublicKey); !errors.Is(err, rsa.ErrBlindingImpossible) {
+		t.Errorf("DecryptStruct: expected ErrBlindingImpossible, got %v", err)
+	}
+
+	// Decrypt draws blinding randomness, the same ciphertext is exponentiated differently each time,
+	// but unblinding always gives the message back.
+	for i := 0; i < 3; i++ {
+		decrypted, err := rsa.Decrypt(encrypted, keys)
+		if err != nil || decrypted != "Hello" {
+			t.Errorf("Expected Hello, got %q, %v", decrypted, err)
+		}
+	}
+}
+
+// Measures decryption of a fixed ciphertext against random ciphertexts and returns Welch's t-statistic.
+// Big value means that timing depends on the ciphertext.
+func decryptionTimingStatistic(t *testing.T, keys *rsa.Keys, decrypt func(cipherText string) error, samples int) float64 {
+	random := mathrand.New(mathrand.NewSource(3))
+	fixed := hex.EncodeToString([]byte{0x02})
+
+	var fixedTimings, randomTimings []float64
+	for i := 0; i < 2*samples; i++ {
+		cipherText := fixed
+		isFixed := random.Intn(2) == 0
+		if !isFixed {
+			cipherText = hex.EncodeToString(new(big.Int).Rand(random, keys.N).Bytes())
+		}
+
+		start := time.Now()
+		if err := decrypt(cipherText); err != nil {
+			t.Fatalf("Decryption failed: %v", err)
+		}
+		elapsed := float64(time.Since(start).Nanoseconds())
+
+		if isFixed {
+			fixedTimings = append(fixedTimings, elapsed)
+		} else {
+			randomTimings = append(randomTimings, elapsed)
+		}
+	}
+
+	meanAndVariance := func(values []float64) (float64, float64) {
+		var mean, variance float64
+		for _, value := range values {
+			mean += value
+		}
+		mean /= float64(len(values))
+		for _, value := range values {
+			variance += (value - mean) * (value - mean)
+		}
+		return mean, variance / float64(len(values)-1)
+	}
+
+	fixedMean, fixedVariance := meanAndVariance(fixedTimings)
+	randomMean, randomVariance := meanAndVariance(randomTimings)
+
+	return (fixedMean - randomMean) / math.Sqrt(fixedVariance/float64(len(fixedTimings))+randomVariance/float64(len(randomTimings)))
+}
+
+func TestBlindingTimingHarness(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Timing harness is skipped in short mode")
+	}
+
+	keys, err := rsa.GenerateKeys(1024)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	// Package never decrypts unblinded, so plain exponentiation is measured as the baseline.
+	unblinded := func(cipherText string) error {
+		c, _ := new(big.Int).SetString(cipherText, 16)
+		new(big.Int).Exp(c, keys.PrivateKey, keys.N)
+		return nil
+	}
+	blinded := func(cipherText string) error {
+		_, err := rsa.DecryptWithKeys(rand.Reader, cipherText, keys)
+		return err
+	}
+
+	// Timings are noisy on shared machines, so the harness reports statistics instead of failing.
+	t.Logf("Unblinded decryption: Welch's t = %.2f", decryptionTimingStatistic(t, keys, unblinded, 200))
+	t.Logf("Blinded decryption: Welch's t = %.2f", decryptionTimingStatistic(t, keys, blinded, 200))
+}
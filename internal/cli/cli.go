@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes returned by Run.
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+// Encodings of binary input and output.
+const (
+	encodingHex    = "hex"
+	encodingBase64 = "base64"
+	encodingRaw    = "raw"
+)
+
+const usage = `Usage: cyphering <command> [flags]
+
+Commands:
+  keygen rsa --bits N [--public-out FILE]     generate RSA key, private key PEM is written to stdout
+  keygen aes --bits N [--output ENC]          generate AES key
+  encrypt --key FILE [--mode MODE]            encrypt input with RSA public or AES key
+  decrypt --key FILE [--mode MODE]            decrypt input with RSA private or AES key
+  sign --key FILE [--scheme SCHEME]           sign SHA-256 of input with RSA private key
+  verify --key FILE --signature FILE          verify signature of input with RSA key
+  encrypt-json --key FILE [--select PATH]...  encrypt JSON document values with RSA public key
+  decrypt-json --key FILE                     decrypt JSON document with RSA private key
+
+Input is read from --in FILE or stdin, output is written to stdout.
+Binary output is encoded with --output hex|base64|raw, binary input is decoded with --input.
+Run "cyphering <command> --help" for flags of a command.
+`
+
+// Environment of a single command run.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command func(e *env, args []string) error
+
+// Usage errors are reported with exit code ExitUsage.
+var errUsage = errors.New("invalid usage")
+
+// Run executes command line arguments (without program name) and returns process exit code.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	commands := map[string]command{
+		"keygen":       runKeygen,
+		"encrypt":      runEncrypt,
+		"decrypt":      runDecrypt,
+		"sign":         runSign,
+		"verify":       runVerify,
+		"encrypt-json": runEncryptJSON,
+		"decrypt-json": runDecryptJSON,
+	}
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(stderr, usage)
+
+		if len(args) == 0 {
+			return ExitUsage
+		}
+		return ExitOK
+	}
+
+	run, ok := commands[args[0]]
+
+	if !ok {
+		fmt.Fprintf(stderr, "cyphering: unknown command %q\n\n%s", args[0], usage)
+
+		return ExitUsage
+	}
+
+	err := run(&env{stdin: stdin, stdout: stdout, stderr: stderr}, args[1:])
+
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(stderr, "cyphering %s: %s\n", args[0], err)
+
+		return ExitUsage
+	default:
+		fmt.Fprintf(stderr, "cyphering %s: %s\n", args[0], err)
+
+		return ExitFailure
+	}
+}
+
+// Creates flag set which reports its errors to stderr.
+func (e *env) flags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+
+	return flags
+}
+
+// Parses flags and rejects unexpected positional arguments.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %s", errUsage, err)
+	}
+
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected argument %q", errUsage, flags.Arg(0))
+	}
+
+	return nil
+}
+
+// Reads input file, "-" means stdin.
+func (e *env) readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(e.stdin)
+	}
+
+	return os.ReadFile(path)
+}
+
+// Writes binary data to stdout in given encoding, text encodings end with a newline.
+func (e *env) writeEncoded(data []byte, encoding string) error {
+	var err error
+
+	switch encoding {
+	case encodingHex:
+		_, err = fmt.Fprintln(e.stdout, hex.EncodeToString(data))
+	case encodingBase64:
+		_, err = fmt.Fprintln(e.stdout, base64.StdEncoding.EncodeToString(data))
+	case encodingRaw:
+		_, err = e.stdout.Write(data)
+	default:
+		err = fmt.Errorf("%w: unknown encoding %q", errUsage, encoding)
+	}
+
+	return err
+}
+
+// Decodes binary data in given encoding, surrounding whitespace of text encodings is ignored.
+func decode(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case encodingHex:
+		decoded, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex input: %w", err)
+		}
+		return decoded, nil
+	case encodingBase64:
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 input: %w", err)
+		}
+		return decoded, nil
+	case encodingRaw:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown encoding %q", errUsage, encoding)
+	}
+}
+
+// Key loaded from --key file: RSA key in PEM or AES key in keyEncoding.
+type key struct {
+	rsa *rsa.Keys
+	aes []byte
+}
+
+func loadKey(path, keyEncoding string) (*key, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: --key is required", errUsage)
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		keys, err := rsa.ParsePEM(data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &key{rsa: keys}, nil
+	}
+
+	aesKey, err := decode(data, keyEncoding)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read AES key: %w", err)
+	}
+
+	if len(aesKey) != 16 && len(aesKey) != 24 && len(aesKey) != 32 {
+		return nil, fmt.Errorf("AES key must be 16, 24 or 32 bytes, got %d", len(aesKey))
+	}
+
+	return &key{aes: aesKey}, nil
+}
+
+// Loads RSA key, private part is required when needPrivate is set.
+func loadRSAKey(path string, needPrivate bool) (*rsa.Keys, error) {
+	loaded, err := loadKey(path, encodingHex)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if loaded.rsa == nil {
+		return nil, errors.New("RSA key in PEM is required")
+	}
+
+	if needPrivate && loaded.rsa.PrivateKey == nil {
+		return nil, errors.New("RSA private key is required")
+	}
+
+	return loaded.rsa, nil
+}
+
+// Repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+
+	return nil
+}
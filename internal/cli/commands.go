@@ -0,0 +1,477 @@
+package cli
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/aes"
+	"github.com/mesiriak/cyphering/pkg/envelope"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"os"
+)
+
+// Encryption modes. RSA keys default to envelope, AES keys to GCM.
+const (
+	modeEnvelope = "envelope"
+	modeOAEP     = "oaep"
+	modeRaw      = "raw"
+	modeGCM      = "gcm"
+	modeCBC      = "cbc"
+	modeECB      = "ecb"
+)
+
+// Signature schemes.
+const (
+	schemePSS      = "pss"
+	schemePKCS1v15 = "pkcs1v15"
+)
+
+func runKeygen(e *env, args []string) error {
+	if len(args) == 0 || (args[0] != "rsa" && args[0] != "aes") {
+		return fmt.Errorf("%w: expected keygen rsa or keygen aes", errUsage)
+	}
+
+	algorithm := args[0]
+	flags := e.flags("keygen " + algorithm)
+
+	if algorithm == "rsa" {
+		bits := flags.Int("bits", 2048, "RSA modulus size")
+		publicOut := flags.String("public-out", "", "file to write public key PEM to")
+
+		if err := parseFlags(flags, args[1:]); err != nil {
+			return err
+		}
+
+		keys, err := rsa.GenerateKeys(*bits)
+
+		if err != nil {
+			return err
+		}
+
+		private, err := rsa.MarshalPrivateKeyPEM(keys, rsa.PKCS1PrivateKeyPEMType)
+
+		if err != nil {
+			return err
+		}
+
+		if *publicOut != "" {
+			public, err := rsa.MarshalPublicKeyPEM(keys.PublicKey, keys.N, rsa.PKIXPublicKeyPEMType)
+
+			if err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(*publicOut, public, 0o644); err != nil {
+				return err
+			}
+		}
+
+		_, err = e.stdout.Write(private)
+		return err
+	}
+
+	bits := flags.Int("bits", 256, "AES key size: 128, 192 or 256")
+	output := flags.String("output", encodingHex, "key encoding: hex, base64 or raw")
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	key, err := aes.GenerateRandomKey(*bits)
+
+	if err != nil {
+		return err
+	}
+
+	return e.writeEncoded(key, *output)
+}
+
+func runEncrypt(e *env, args []string) error {
+	flags := e.flags("encrypt")
+	keyPath := flags.String("key", "", "RSA key PEM or AES key file")
+	keyEncoding := flags.String("key-encoding", encodingHex, "AES key file encoding: hex, base64 or raw")
+	in := flags.String("in", "-", "input file, - for stdin")
+	output := flags.String("output", encodingHex, "output encoding: hex, base64 or raw")
+	mode := flags.String("mode", "", "RSA: envelope, oaep or raw; AES: gcm, cbc or ecb")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	loaded, err := loadKey(*keyPath, *keyEncoding)
+
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := e.readInput(*in)
+
+	if err != nil {
+		return err
+	}
+
+	var ciphertext []byte
+
+	if loaded.rsa != nil {
+		ciphertext, err = encryptRSA(plaintext, loaded.rsa, *mode)
+	} else {
+		ciphertext, err = encryptAES(plaintext, loaded.aes, *mode)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return e.writeEncoded(ciphertext, *output)
+}
+
+func runDecrypt(e *env, args []string) error {
+	flags := e.flags("decrypt")
+	keyPath := flags.String("key", "", "RSA private key PEM or AES key file")
+	keyEncoding := flags.String("key-encoding", encodingHex, "AES key file encoding: hex, base64 or raw")
+	in := flags.String("in", "-", "input file, - for stdin")
+	input := flags.String("input", encodingHex, "input encoding: hex, base64 or raw")
+	mode := flags.String("mode", "", "RSA: envelope, oaep or raw; AES: gcm, cbc or ecb")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	loaded, err := loadKey(*keyPath, *keyEncoding)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := e.readInput(*in)
+
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := decode(data, *input)
+
+	if err != nil {
+		return err
+	}
+
+	var plaintext []byte
+
+	if loaded.rsa != nil {
+		if loaded.rsa.PrivateKey == nil {
+			return errors.New("RSA private key is required")
+		}
+
+		plaintext, err = decryptRSA(ciphertext, loaded.rsa, *mode)
+	} else {
+		plaintext, err = decryptAES(ciphertext, loaded.aes, *mode)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = e.stdout.Write(plaintext)
+	return err
+}
+
+func encryptRSA(plaintext []byte, keys *rsa.Keys, mode string) ([]byte, error) {
+	switch mode {
+	case "", modeEnvelope:
+		return envelope.Seal(rand.Reader, plaintext, keys.PublicKey, keys.N)
+	case modeOAEP:
+		return rsa.EncryptOAEP(sha256.New(), rand.Reader, plaintext, nil, keys.PublicKey, keys.N)
+	case modeRaw:
+		// Textbook RSA used by the GUI, leading zero bytes of input are lost.
+		encrypted, err := rsa.Encrypt(string(plaintext), keys.PublicKey, keys.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return hex.DecodeString(encrypted)
+	default:
+		return nil, fmt.Errorf("%w: unknown RSA mode %q", errUsage, mode)
+	}
+}
+
+func decryptRSA(ciphertext []byte, keys *rsa.Keys, mode string) ([]byte, error) {
+	switch mode {
+	case "", modeEnvelope:
+		return envelope.Open(rand.Reader, ciphertext, keys)
+	case modeOAEP:
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, ciphertext, nil, keys)
+	case modeRaw:
+		decrypted, err := rsa.DecryptWithKeys(rand.Reader, hex.EncodeToString(ciphertext), keys)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(decrypted), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown RSA mode %q", errUsage, mode)
+	}
+}
+
+// GCM output is nonce followed by ciphertext and tag, CBC output starts with IV.
+func encryptAES(plaintext, key []byte, mode string) ([]byte, error) {
+	switch mode {
+	case "", modeGCM:
+		nonce := make([]byte, aes.GCMNonceSize)
+
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+
+		sealed, err := aes.SealGCM(plaintext, key, len(key)*8, nonce, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return append(nonce, sealed...), nil
+	case modeCBC:
+		return aes.EncryptCBC(plaintext, key, len(key)*8)
+	case modeECB:
+		return aes.EncryptBytes(plaintext, key, len(key)*8)
+	default:
+		return nil, fmt.Errorf("%w: unknown AES mode %q", errUsage, mode)
+	}
+}
+
+func decryptAES(ciphertext, key []byte, mode string) ([]byte, error) {
+	switch mode {
+	case "", modeGCM:
+		if len(ciphertext) < aes.GCMNonceSize {
+			return nil, errors.New("ciphertext is too short")
+		}
+
+		return aes.OpenGCM(ciphertext[aes.GCMNonceSize:], key, len(key)*8, ciphertext[:aes.GCMNonceSize], nil)
+	case modeCBC:
+		return aes.DecryptCBC(ciphertext, key, len(key)*8)
+	case modeECB:
+		return aes.DecryptBytes(ciphertext, key, len(key)*8)
+	default:
+		return nil, fmt.Errorf("%w: unknown AES mode %q", errUsage, mode)
+	}
+}
+
+func runSign(e *env, args []string) error {
+	flags := e.flags("sign")
+	keyPath := flags.String("key", "", "RSA private key PEM file")
+	in := flags.String("in", "-", "input file, - for stdin")
+	output := flags.String("output", encodingHex, "signature encoding: hex, base64 or raw")
+	scheme := flags.String("scheme", schemePSS, "signature scheme: pss or pkcs1v15")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	keys, err := loadRSAKey(*keyPath, true)
+
+	if err != nil {
+		return err
+	}
+
+	message, err := e.readInput(*in)
+
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256(message)
+
+	var signature []byte
+
+	switch *scheme {
+	case schemePSS:
+		signature, err = rsa.SignPSS(rand.Reader, crypto.SHA256, hashed[:], rsa.PSSSaltLengthEqualsHash, keys)
+	case schemePKCS1v15:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, crypto.SHA256, hashed[:], keys)
+	default:
+		return fmt.Errorf("%w: unknown signature scheme %q", errUsage, *scheme)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return e.writeEncoded(signature, *output)
+}
+
+func runVerify(e *env, args []string) error {
+	flags := e.flags("verify")
+	keyPath := flags.String("key", "", "RSA public or private key PEM file")
+	in := flags.String("in", "-", "input file, - for stdin")
+	signaturePath := flags.String("signature", "", "signature file")
+	input := flags.String("input", encodingHex, "signature encoding: hex, base64 or raw")
+	scheme := flags.String("scheme", schemePSS, "signature scheme: pss or pkcs1v15")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *signaturePath == "" {
+		return fmt.Errorf("%w: --signature is required", errUsage)
+	}
+
+	keys, err := loadRSAKey(*keyPath, false)
+
+	if err != nil {
+		return err
+	}
+
+	encodedSignature, err := os.ReadFile(*signaturePath)
+
+	if err != nil {
+		return err
+	}
+
+	signature, err := decode(encodedSignature, *input)
+
+	if err != nil {
+		return err
+	}
+
+	message, err := e.readInput(*in)
+
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256(message)
+
+	switch *scheme {
+	case schemePSS:
+		err = rsa.VerifyPSS(crypto.SHA256, hashed[:], signature, rsa.PSSSaltLengthAuto, keys.PublicKey, keys.N)
+	case schemePKCS1v15:
+		err = rsa.VerifyPKCS1v15(crypto.SHA256, hashed[:], signature, keys.PublicKey, keys.N)
+	default:
+		return fmt.Errorf("%w: unknown signature scheme %q", errUsage, *scheme)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(e.stdout, "OK")
+	return err
+}
+
+func runEncryptJSON(e *env, args []string) error {
+	flags := e.flags("encrypt-json")
+	keyPath := flags.String("key", "", "RSA public or private key PEM file")
+	in := flags.String("in", "-", "input file, - for stdin")
+	encryptKeys := flags.Bool("encrypt-keys", false, "tokenize object keys as well as values")
+	var selectors stringList
+	flags.Var(&selectors, "select", "encrypt only values matching path like $.user.ssn, repeatable")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *encryptKeys && len(selectors) > 0 {
+		return fmt.Errorf("%w: --encrypt-keys cannot be combined with --select", errUsage)
+	}
+
+	keys, err := loadRSAKey(*keyPath, false)
+
+	if err != nil {
+		return err
+	}
+
+	document, err := e.readJSON(*in)
+
+	if err != nil {
+		return err
+	}
+
+	var encrypted interface{}
+
+	switch {
+	case len(selectors) > 0:
+		encrypted, err = rsa.EncryptFields(document, selectors, keys.PublicKey, keys.N)
+	case *encryptKeys:
+		encrypted, err = rsa.EncryptStructWithKeys(document, keys.PublicKey, keys.N)
+	default:
+		encrypted, err = rsa.EncryptStruct(document, keys.PublicKey, keys.N)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return e.writeJSON(encrypted)
+}
+
+func runDecryptJSON(e *env, args []string) error {
+	flags := e.flags("decrypt-json")
+	keyPath := flags.String("key", "", "RSA private key PEM file")
+	in := flags.String("in", "-", "input file, - for stdin")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	keys, err := loadRSAKey(*keyPath, true)
+
+	if err != nil {
+		return err
+	}
+
+	document, err := e.readJSON(*in)
+
+	if err != nil {
+		return err
+	}
+
+	// Partially encrypted documents are accepted, so output of any encrypt-json mode can be decrypted.
+	decrypted, err := rsa.DecryptFields(document, keys)
+
+	if err != nil {
+		return err
+	}
+
+	return e.writeJSON(decrypted)
+}
+
+// Reads single JSON document keeping numbers as written.
+func (e *env) readJSON(path string) (interface{}, error) {
+	data, err := e.readInput(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document interface{}
+
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid JSON input: %w", err)
+	}
+
+	if decoder.More() {
+		return nil, errors.New("invalid JSON input: more than one document")
+	}
+
+	return document, nil
+}
+
+func (e *env) writeJSON(document interface{}) error {
+	encoded, err := json.Marshal(document)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(e.stdout, string(encoded))
+	return err
+}
@@ -9,6 +9,7 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 	"github.com/mesiriak/cyphering/pkg/aes"
+	"github.com/mesiriak/cyphering/pkg/exchange"
 	"github.com/mesiriak/cyphering/pkg/rsa"
 )
 
@@ -17,7 +18,7 @@ func NewGUI() (fyne.App, error) {
 	state.window = state.application.NewWindow("Cyphering")
 
 	// Set position and size.
-	state.window.Resize(fyne.NewSize(1020, 960))
+	state.window.Resize(fyne.NewSize(1020, 1100))
 	state.window.CenterOnScreen()
 	state.window.SetFixedSize(true)
 
@@ -25,6 +26,7 @@ func NewGUI() (fyne.App, error) {
 	keysManipulatorContainer := NewRSAKeysManipulatorContainer()
 	requestEntriesContainer := NewRequestEntriesContainer()
 	requestButtonsContainer := NewRequestButtonsContainer()
+	trafficContainer := NewTrafficContainer()
 
 	aesKeysManipulatorContainer := NewAESKeysManipulatorContainer()
 	aesRequestEntriesContainer := NewAESRequestEntriesContainer()
@@ -36,6 +38,7 @@ func NewGUI() (fyne.App, error) {
 			keysManipulatorContainer,
 			requestEntriesContainer,
 			requestButtonsContainer,
+			trafficContainer,
 			aesKeysManipulatorContainer,
 			aesRequestEntriesContainer,
 			aesRequestButtonsContainer,
@@ -69,8 +72,9 @@ func NewRSAKeysContainer() *fyne.Container {
 }
 
 func NewRSAKeysManipulatorContainer() *fyne.Container {
+	// Smaller keys cannot exchange with the server or encrypt JSON values.
 	keyBitSizeEntry := NewRSAKeyBitSizeSelect(
-		[]string{"32", "64", "128", "256", "512", "1024", "2048", "4096"},
+		[]string{"1024", "2048", "4096"},
 	)
 
 	generateKeysButton := widget.NewButton("Generate Keys", func() {
@@ -96,13 +100,14 @@ func NewRSAKeysManipulatorContainer() *fyne.Container {
 			return
 		}
 
-		state.keys = keys
+		state.setKeys(keys)
 		state.fillKeysEntries()
+		state.clearServerKeysEntries()
 	})
 
-	exchangeKeysButton := widget.NewButton("Exchange Keys", func() {
-		keys, err := rsa.GenerateKeys(state.bitSize)
+	var exchangeKeysButton *widget.Button
 
+	exchangeKeysButton = widget.NewButton("Exchange Keys", func() {
 		if state.keys == nil {
 			dialog.NewInformation(
 				"Error during exchanging",
@@ -113,18 +118,53 @@ func NewRSAKeysManipulatorContainer() *fyne.Container {
 			return
 		}
 
-		if err != nil {
+		// Server encrypts responses with client keys, so it rejects keys too small for them.
+		if state.keys.N.BitLen() < exchange.MinKeySize {
 			dialog.NewInformation(
-				"Error happened",
-				fmt.Sprintf("Error while generating rsa keys: %s", err),
+				"Error during exchanging",
+				fmt.Sprintf(
+					"Server cannot encrypt responses for %d-bit keys. Generate keys of at least %d bits before exchanging.",
+					state.keys.N.BitLen(),
+					exchange.MinKeySize,
+				),
 				state.window,
 			).Show()
 
 			return
 		}
 
-		state.serverKeys = keys
-		state.fillServerKeysEntries()
+		state.disconnect()
+		state.clearServerKeysEntries()
+		state.appendTraffic("**", fmt.Sprintf("connecting to %s", exchange.DefaultAddress))
+
+		// Connecting may take up to the dial and request timeouts, so it runs off the UI callback.
+		keys := state.keys
+		exchangeKeysButton.Disable()
+
+		go func() {
+			defer exchangeKeysButton.Enable()
+
+			client, err := exchange.Dial(exchange.DefaultAddress, keys, state.appendTraffic)
+
+			if err != nil {
+				dialog.NewInformation(
+					"Error during exchanging",
+					fmt.Sprintf("Cannot exchange keys with server at %s: %s\n\nStart it with: go run ./cmd/server", exchange.DefaultAddress, err),
+					state.window,
+				).Show()
+
+				return
+			}
+
+			// Keys were regenerated while connecting, the exchange is stale.
+			if !state.connect(keys, client) {
+				_ = client.Close()
+
+				return
+			}
+
+			state.fillServerKeysEntries(client.ServerKeys())
+		}()
 	})
 
 	return container.NewGridWithRows(1, keyBitSizeEntry, generateKeysButton, exchangeKeysButton)
@@ -158,6 +198,8 @@ func NewAESKeysManipulatorContainer() *fyne.Container {
 				fmt.Sprintf("Error while generating AES keys: %s", err),
 				state.window,
 			).Show()
+
+			return
 		}
 
 		state.aesKey = hex.EncodeToString(key)
@@ -173,7 +215,7 @@ func NewAESKeysManipulatorContainer() *fyne.Container {
 
 func NewRequestEntriesContainer() *fyne.Container {
 	requestEntry, requestEntryLayout := NewRequestEntry(true)
-	encodedRequestEntry, encodedRequestEntryLayout := NewRequestEntry(false)
+	encodedRequestEntry, encodedRequestEntryLayout := NewRequestEntry(true)
 
 	state.requestEntry = requestEntry
 	state.encodedRequestEntry = encodedRequestEntry
@@ -198,9 +240,26 @@ func NewRequestEntriesContainer() *fyne.Container {
 	)
 }
 
+func NewTrafficContainer() *fyne.Container {
+	trafficEntry, trafficEntryLayout := NewRequestEntry(false)
+
+	state.trafficEntry = trafficEntry
+
+	return container.NewVBox(
+		container.NewGridWrap(
+			fyne.Size{Height: 40, Width: 1020},
+			NewHeaderLabel("Server Traffic"),
+		),
+		container.NewGridWrap(
+			fyne.Size{Height: 100, Width: 1020},
+			trafficEntryLayout,
+		),
+	)
+}
+
 func NewAESRequestEntriesContainer() *fyne.Container {
 	aesRequestEntry, aesRequestEntryLayout := NewRequestEntry(true)
-	aesEncodedRequestEntry, aesEncodedRequestEntryLayout := NewRequestEntry(false)
+	aesEncodedRequestEntry, aesEncodedRequestEntryLayout := NewRequestEntry(true)
 
 	state.aesRequestEntry = aesRequestEntry
 	state.aesEncodedRequestEntry = aesEncodedRequestEntry
@@ -229,12 +288,21 @@ func NewRequestButtonsContainer() *fyne.Container {
 
 	sendRawButton := widget.NewButton("Encrypt raw", sendRawData)
 	sendJsonButton := widget.NewButton("Encrypt JSON", sendJsonData)
-
-	return container.NewGridWithColumns(2, sendRawButton, sendJsonButton)
+	receiveRawButton := widget.NewButton("Decrypt raw", receiveRawData)
+	receiveJsonButton := widget.NewButton("Decrypt JSON", receiveJsonData)
+
+	return container.NewGridWithColumns(
+		4,
+		sendRawButton,
+		sendJsonButton,
+		receiveRawButton,
+		receiveJsonButton,
+	)
 }
 
 func NewAESRequestButtonsContainer() *fyne.Container {
 	encryptRawButton := widget.NewButton("Encrypt raw", sendAESRawData)
+	decryptRawButton := widget.NewButton("Decrypt raw", receiveAESRawData)
 
-	return container.NewGridWithColumns(1, encryptRawButton)
+	return container.NewGridWithColumns(2, encryptRawButton, decryptRawButton)
 }
@@ -69,7 +69,7 @@ func NewAESKeyBitSizeSelect(choices []string) *widget.Select {
 	keyBitSizeSelect := widget.NewSelect(
 		choices,
 		func(s string) {
-			state.clearKeysEntries()
+			state.clearAESKeysEntries()
 			state.aesBitSize, _ = strconv.Atoi(s)
 		},
 	)
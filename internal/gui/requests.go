@@ -6,9 +6,15 @@ import (
 	"fmt"
 	"fyne.io/fyne/v2/dialog"
 	"github.com/mesiriak/cyphering/pkg/aes"
+	"github.com/mesiriak/cyphering/pkg/envelope"
+	"github.com/mesiriak/cyphering/pkg/exchange"
 	"github.com/mesiriak/cyphering/pkg/rsa"
+	"strings"
+	"unicode/utf8"
 )
 
+const wrongKeysAlert = "Decrypted data is not valid text, check that it was encrypted for the current keys."
+
 func sendRawData() {
 	isSendingPossible, alert := state.checkSendingPossible()
 
@@ -18,11 +24,7 @@ func sendRawData() {
 		return
 	}
 
-	encoded, err := rsa.Encrypt(
-		state.requestEntry.Text,
-		state.serverKeys.PublicKey,
-		state.serverKeys.N,
-	)
+	encoded, err := encryptRawData(state.requestEntry.Text, state.encryptionKeys())
 
 	if err != nil {
 		dialog.NewInformation("Error during sending message", fmt.Sprintf("%s", err), state.window).Show()
@@ -31,6 +33,8 @@ func sendRawData() {
 	}
 
 	state.encodedRequestEntry.SetText(encoded)
+
+	sendToServer(exchange.FormatRaw, state.requestEntry.Text)
 }
 
 func sendJsonData() {
@@ -52,15 +56,18 @@ func sendJsonData() {
 
 	var unmarshalledJsonData interface{}
 
-	if err := json.Unmarshal([]byte(state.requestEntry.Text), &unmarshalledJsonData); err != nil {
+	// Numbers are kept as json.Number, so they are encrypted exactly as they were written.
+	decoder := json.NewDecoder(strings.NewReader(state.requestEntry.Text))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&unmarshalledJsonData); err != nil {
 		dialog.NewInformation("Error during marshalling json", fmt.Sprintf("%s", err), state.window).Show()
+
+		return
 	}
 
-	encoded, err := rsa.EncryptStruct(
-		unmarshalledJsonData,
-		state.serverKeys.PublicKey,
-		state.serverKeys.N,
-	)
+	keys := state.encryptionKeys()
+	encoded, err := rsa.EncryptStruct(unmarshalledJsonData, keys.PublicKey, keys.N)
 
 	if err != nil {
 		dialog.NewInformation("Error during sending message", fmt.Sprintf("%s", err), state.window).Show()
@@ -77,6 +84,36 @@ func sendJsonData() {
 	}
 
 	state.encodedRequestEntry.SetText(string(marshalledEncodedJson))
+
+	sendToServer(exchange.FormatJSON, state.requestEntry.Text)
+}
+
+// Sends request to the server when keys were exchanged with it and logs decrypted response.
+// Request runs in background, so a slow server does not freeze the window.
+func sendToServer(format, body string) {
+	client := state.connection()
+
+	if client == nil {
+		return
+	}
+
+	send := client.SendRaw
+
+	if format == exchange.FormatJSON {
+		send = client.SendJSON
+	}
+
+	go func() {
+		response, err := send(body)
+
+		if err != nil {
+			dialog.NewInformation("Error during sending message", fmt.Sprintf("%s", err), state.window).Show()
+
+			return
+		}
+
+		state.appendTraffic("**", fmt.Sprintf("decrypted response: %s", response))
+	}()
 }
 
 func sendAESRawData() {
@@ -96,8 +133,8 @@ func sendAESRawData() {
 		return
 	}
 
-	encoded, err := aes.Encrypt(
-		state.aesRequestEntry.Text,
+	encoded, err := aes.EncryptBytes(
+		[]byte(state.aesRequestEntry.Text),
 		decodedKey,
 		state.aesBitSize,
 	)
@@ -108,5 +145,159 @@ func sendAESRawData() {
 		return
 	}
 
-	state.aesEncodedRequestEntry.SetText(hex.EncodeToString([]byte(encoded)))
+	state.aesEncodedRequestEntry.SetText(hex.EncodeToString(encoded))
+}
+
+func receiveRawData() {
+	isDecryptingPossible, alert := state.checkDecryptingPossible()
+
+	if !isDecryptingPossible {
+		dialog.NewInformation("Error during decrypting message", alert, state.window).Show()
+
+		return
+	}
+
+	cipherText := strings.TrimSpace(state.encodedRequestEntry.Text)
+
+	if _, err := hex.DecodeString(cipherText); err != nil {
+		dialog.NewInformation("Error during decrypting message", "Encoded text is not valid hex.", state.window).Show()
+
+		return
+	}
+
+	// Only client private key is known, server responses are encrypted for it as well.
+	keys := state.keys
+	decoded, err := decryptRawData(cipherText, keys)
+
+	if err != nil {
+		dialog.NewInformation("Error during decrypting message", fmt.Sprintf("%s", err), state.window).Show()
+
+		return
+	}
+
+	if !utf8.ValidString(decoded) {
+		dialog.NewInformation("Error during decrypting message", wrongKeysAlert, state.window).Show()
+
+		return
+	}
+
+	state.requestEntry.SetText(decoded)
+}
+
+func receiveJsonData() {
+	isDecryptingPossible, alert := state.checkDecryptingPossible()
+
+	if !isDecryptingPossible {
+		dialog.NewInformation("Error during decrypting message", alert, state.window).Show()
+
+		return
+	}
+
+	var unmarshalledJsonData interface{}
+
+	decoder := json.NewDecoder(strings.NewReader(state.encodedRequestEntry.Text))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&unmarshalledJsonData); err != nil {
+		dialog.NewInformation("Error during unmarshalling json", fmt.Sprintf("%s", err), state.window).Show()
+
+		return
+	}
+
+	// Only client private key is known, server responses are encrypted for it as well.
+	keys := state.keys
+	decoded, err := rsa.DecryptStruct(unmarshalledJsonData, keys)
+
+	if err != nil {
+		// Hex errors are shown as they are, values encrypted for other keys, like requests
+		// sent to the server, fail OAEP padding check.
+		dialog.NewInformation("Error during decrypting message", fmt.Sprintf("%s\n\n%s", err, wrongKeysAlert), state.window).Show()
+
+		return
+	}
+
+	marshalledDecodedJson, err := json.MarshalIndent(decoded, "", "  ")
+
+	if err != nil {
+		dialog.NewInformation("Error during marshalling json", fmt.Sprintf("%s", err), state.window).Show()
+
+		return
+	}
+
+	state.requestEntry.SetText(string(marshalledDecodedJson))
+}
+
+func receiveAESRawData() {
+	isDecryptingPossible, alert := state.checkAESDecryptingPossible()
+
+	if !isDecryptingPossible {
+		dialog.NewInformation("Error during decrypting AES message", alert, state.window).Show()
+
+		return
+	}
+
+	decodedKey, err := hex.DecodeString(state.aesKey)
+
+	if err != nil {
+		dialog.NewInformation("Error during decoding AES key", "Key cannot be decoded.", state.window).Show()
+
+		return
+	}
+
+	cipherText, err := hex.DecodeString(strings.TrimSpace(state.aesEncodedRequestEntry.Text))
+
+	if err != nil {
+		dialog.NewInformation("Error during decrypting AES message", "Encoded text is not valid hex.", state.window).Show()
+
+		return
+	}
+
+	decoded, err := aes.DecryptBytes(cipherText, decodedKey, state.aesBitSize)
+
+	if err != nil {
+		// Padding check is the only integrity check of this mode, so wrong key usually fails here.
+		dialog.NewInformation(
+			"Error during decrypting AES message",
+			fmt.Sprintf("%s\n\nCheck that the message was encrypted with the current AES key.", err),
+			state.window,
+		).Show()
+
+		return
+	}
+
+	if !utf8.Valid(decoded) {
+		dialog.NewInformation("Error during decrypting AES message", wrongKeysAlert, state.window).Show()
+
+		return
+	}
+
+	state.aesRequestEntry.SetText(string(decoded))
+}
+
+// Encrypts text of any length into a hex envelope, the same format raw exchange payloads use.
+func encryptRawData(text string, keys *rsa.Keys) (string, error) {
+	sealed, err := envelope.Seal(nil, []byte(text), keys.PublicKey, keys.N)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(sealed), nil
+}
+
+// Decrypts output of encryptRawData and raw responses of the server.
+func decryptRawData(cipherText string, keys *rsa.Keys) (string, error) {
+	sealed, err := hex.DecodeString(cipherText)
+
+	if err != nil {
+		return "", err
+	}
+
+	opened, err := envelope.Open(nil, sealed, keys)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(opened), nil
 }
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/widget"
+	"github.com/mesiriak/cyphering/pkg/exchange"
 	"github.com/mesiriak/cyphering/pkg/rsa"
 	"strings"
+	"sync"
 )
 
 type State struct {
@@ -13,6 +15,16 @@ type State struct {
 	serverKeys *rsa.Keys
 	aesKey     string
 
+	// Connection to the server, set by key exchange.
+	client *exchange.Client
+
+	// Guards keys, serverKeys and client, because key exchange runs in background. Keys are
+	// written only by UI callbacks, so UI callbacks may read them without locking.
+	connectionMutex sync.Mutex
+
+	// Serializes traffic log updates, they come from exchange goroutines.
+	trafficMutex sync.Mutex
+
 	bitSize    int
 	aesBitSize int
 
@@ -31,19 +43,78 @@ type State struct {
 
 	aesRequestEntry        *widget.Entry
 	aesEncodedRequestEntry *widget.Entry
+
+	trafficEntry *widget.Entry
 }
 
 func (s *State) clearKeysEntries() {
 	s.publicKeyEntry.SetText("")
 	s.privateKeyEntry.SetText("")
-	s.serverPublicKeyEntry.SetText("")
 	s.nEntry.SetText("")
+	s.clearServerKeysEntries()
+
+	s.setKeys(nil)
+}
+
+func (s *State) clearServerKeysEntries() {
+	s.serverPublicKeyEntry.SetText("")
 	s.serverNEntry.SetText("")
+}
+
+func (s *State) setKeys(keys *rsa.Keys) {
+	s.disconnect()
+
+	s.connectionMutex.Lock()
+	defer s.connectionMutex.Unlock()
+
+	s.keys = keys
+}
+
+// Closes connection to the server and forgets its keys.
+func (s *State) disconnect() {
+	s.connectionMutex.Lock()
+	defer s.connectionMutex.Unlock()
+
+	if s.client != nil {
+		_ = s.client.Close()
+		s.client = nil
+	}
 
-	s.keys = nil
 	s.serverKeys = nil
 }
 
+// Stores connection made with keys, unless keys were replaced while connecting.
+func (s *State) connect(keys *rsa.Keys, client *exchange.Client) bool {
+	s.connectionMutex.Lock()
+	defer s.connectionMutex.Unlock()
+
+	if s.keys != keys {
+		return false
+	}
+
+	s.client = client
+	s.serverKeys = client.ServerKeys()
+
+	return true
+}
+
+// Returns connection to the server, nil before key exchange.
+func (s *State) connection() *exchange.Client {
+	s.connectionMutex.Lock()
+	defer s.connectionMutex.Unlock()
+
+	return s.client
+}
+
+// Appends line to the traffic log, used as exchange.Trace as well.
+func (s *State) appendTraffic(direction string, line string) {
+	s.trafficMutex.Lock()
+	defer s.trafficMutex.Unlock()
+
+	s.trafficEntry.SetText(s.trafficEntry.Text + direction + " " + line + "\n")
+	s.trafficEntry.CursorRow = len(strings.Split(s.trafficEntry.Text, "\n"))
+}
+
 func (s *State) clearAESKeysEntries() {
 	s.aesKeyEntry.SetText("")
 
@@ -60,13 +131,13 @@ func (s *State) fillKeysEntries() {
 	s.nEntry.SetText(s.keys.N.Text(10))
 }
 
-func (s *State) fillServerKeysEntries() {
-	s.serverPublicKeyEntry.SetText(s.serverKeys.PublicKey.Text(10))
-	s.serverNEntry.SetText(s.serverKeys.N.Text(10))
+func (s *State) fillServerKeysEntries(serverKeys *rsa.Keys) {
+	s.serverPublicKeyEntry.SetText(serverKeys.PublicKey.Text(10))
+	s.serverNEntry.SetText(serverKeys.N.Text(10))
 }
 
 func (s *State) checkSendingPossible() (bool, string) {
-	if s.keys == nil || s.serverKeys == nil {
+	if s.keys == nil {
 		return false, "You have to generate RSA keys first."
 	}
 
@@ -88,6 +159,42 @@ func (s *State) checkAESSendingPossible() (bool, string) {
 	return true, ""
 }
 
+func (s *State) checkDecryptingPossible() (bool, string) {
+	if s.keys == nil {
+		return false, "You have to generate RSA keys first."
+	}
+
+	if strings.TrimSpace(s.encodedRequestEntry.Text) == "" {
+		return false, "Enter encoded data before decrypting."
+	}
+
+	return true, ""
+}
+
+func (s *State) checkAESDecryptingPossible() (bool, string) {
+	if s.aesKey == "" {
+		return false, "You have to generate AES key first."
+	}
+	if strings.TrimSpace(s.aesEncodedRequestEntry.Text) == "" {
+		return false, "Enter encoded data before decrypting."
+	}
+
+	return true, ""
+}
+
+// Requests are encrypted for the server after key exchange, before it for the client keys,
+// so encrypting and decrypting work without a server too.
+func (s *State) encryptionKeys() *rsa.Keys {
+	s.connectionMutex.Lock()
+	defer s.connectionMutex.Unlock()
+
+	if s.serverKeys != nil {
+		return s.serverKeys
+	}
+
+	return s.keys
+}
+
 func (s *State) checkJsonValid() (bool, string) {
 	var js json.RawMessage
 
@@ -0,0 +1,70 @@
+package aes
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+// EncryptCBC encrypts data in CBC mode with a random IV, the IV is prepended to the ciphertext.
+func EncryptCBC(data []byte, key []byte, keySizeBits int) ([]byte, error) {
+	iv := make([]byte, blockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	ciphertext, err := EncryptCBCWithIV(data, key, keySizeBits, iv)
+	if err != nil {
+		return nil, err
+	}
+	return append(iv, ciphertext...), nil
+}
+
+// DecryptCBC decrypts output of EncryptCBC, the first block is used as IV.
+func DecryptCBC(data []byte, key []byte, keySizeBits int) ([]byte, error) {
+	if len(data) < 2*blockSize {
+		return nil, errors.New("incorrect length of ciphertext")
+	}
+	return DecryptCBCWithIV(data[blockSize:], key, keySizeBits, data[:blockSize])
+}
+
+// EncryptCBCWithIV encrypts data in CBC mode with the given IV. IV is not included in the output.
+func EncryptCBCWithIV(data []byte, key []byte, keySizeBits int, iv []byte) ([]byte, error) {
+	if len(iv) != blockSize {
+		return nil, errors.New("incorrect length of IV")
+	}
+	block, err := newCipher(key, keySizeBits)
+	if err != nil {
+		return nil, err
+	}
+	// Copy data, so padding never touches the caller's slice.
+	padded := ApplyPadding(append([]byte(nil), data...))
+	ciphertext := make([]byte, len(padded))
+	previous := iv
+	for i := 0; i < len(padded); i += blockSize {
+		xorBytes(ciphertext[i:i+blockSize], padded[i:i+blockSize], previous)
+		block.Encrypt(ciphertext[i:], ciphertext[i:])
+		previous = ciphertext[i : i+blockSize]
+	}
+	return ciphertext, nil
+}
+
+// DecryptCBCWithIV decrypts data in CBC mode with the given IV and removes padding.
+func DecryptCBCWithIV(data []byte, key []byte, keySizeBits int, iv []byte) ([]byte, error) {
+	if len(iv) != blockSize {
+		return nil, errors.New("incorrect length of IV")
+	}
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, errors.New("incorrect length of ciphertext")
+	}
+	block, err := newCipher(key, keySizeBits)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(data))
+	previous := iv
+	for i := 0; i < len(data); i += blockSize {
+		block.Decrypt(plaintext[i:], data[i:])
+		xorBytes(plaintext[i:i+blockSize], plaintext[i:i+blockSize], previous)
+		previous = data[i : i+blockSize]
+	}
+	return RemovePadding(plaintext)
+}
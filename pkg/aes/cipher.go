@@ -0,0 +1,92 @@
+package aes
+
+import (
+	"crypto/cipher"
+	"errors"
+)
+
+// Core selects the implementation of AES rounds used by Cipher.
+type Core int
+
+const (
+	// TableCore uses T-tables. It is the fastest core, but table lookups are indexed by secret data.
+	TableCore Core = iota
+	// ConstantTimeCore uses a bitsliced S-box and branch-free multiplication, it is slower but does not leak timing.
+	ConstantTimeCore
+)
+
+// Cipher holds an expanded AES key and implements cipher.Block.
+// Output of every core is identical to EncryptBlock/DecryptBlock.
+type Cipher struct {
+	w    []uint32
+	dw   []uint32
+	nr   int
+	core Core
+}
+
+var _ cipher.Block = (*Cipher)(nil)
+
+// NewCipher expands the key for TableCore, key size (128, 192 or 256 bits) is taken from the key length.
+func NewCipher(key []byte) (*Cipher, error) {
+	return newCipher(key, len(key)*8)
+}
+
+// NewCipherWithCore expands the key for the selected core.
+func NewCipherWithCore(key []byte, core Core) (*Cipher, error) {
+	switch core {
+	case TableCore:
+		return NewCipher(key)
+	case ConstantTimeCore:
+		w, Nr, err := expandKey(key, len(key)*8, subWordConstantTime)
+		if err != nil {
+			return nil, err
+		}
+		return &Cipher{w: w, nr: Nr, core: ConstantTimeCore}, nil
+	default:
+		return nil, errors.New("unknown AES core")
+	}
+}
+
+// Expands the key validating it against keySizeBits like KeyExpansion does.
+func newCipher(key []byte, keySizeBits int) (*Cipher, error) {
+	w, Nr, err := KeyExpansion(key, keySizeBits)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{w: w, dw: expandDecryptionKey(w), nr: Nr, core: TableCore}, nil
+}
+
+// BlockSize returns the AES block size - 16 bytes.
+func (c *Cipher) BlockSize() int {
+	return blockSize
+}
+
+// Encrypt encrypts the first block of src into dst, dst and src may overlap.
+func (c *Cipher) Encrypt(dst, src []byte) {
+	checkBlocks(dst, src)
+	if c.core == ConstantTimeCore {
+		encryptBlockConstantTime(c.w, c.nr, dst, src)
+		return
+	}
+	encryptBlockTables(c.w, c.nr, dst, src)
+}
+
+// Decrypt decrypts the first block of src into dst, dst and src may overlap.
+func (c *Cipher) Decrypt(dst, src []byte) {
+	checkBlocks(dst, src)
+	if c.core == ConstantTimeCore {
+		decryptBlockConstantTime(c.w, c.nr, dst, src)
+		return
+	}
+	decryptBlockTables(c.dw, c.nr, dst, src)
+}
+
+// Panics like the standard library ciphers do when buffers are shorter than a block.
+func checkBlocks(dst, src []byte) {
+	if len(src) < blockSize {
+		panic("aes: input not full block")
+	}
+	if len(dst) < blockSize {
+		panic("aes: output not full block")
+	}
+}
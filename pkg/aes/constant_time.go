@@ -0,0 +1,174 @@
+package aes
+
+// Constant time AES core. The S-box is computed with bitsliced arithmetic in GF(2^8) over all 16 state
+// bytes at once and MixColumns uses branch-free multiplication, so neither memory access pattern nor
+// branches depend on the key or the data.
+
+// Bitsliced representation of up to 16 bytes: plane i holds bit i of every byte, one byte per bit position.
+type bitslice [8]uint16
+
+// Encrypts one block without secret dependent lookups or branches, same output as EncryptBlock.
+func encryptBlockConstantTime(w []uint32, Nr int, dst, src []byte) {
+	var state [blockSize]byte
+	copy(state[:], src)
+
+	addRoundKey(state[:], w, 0)
+	for round := 1; round < Nr; round++ {
+		subBytesConstantTime(state[:])
+		shiftRows(state[:])
+		mixColumnsConstantTime(state[:])
+		addRoundKey(state[:], w, round)
+	}
+	subBytesConstantTime(state[:])
+	shiftRows(state[:])
+	addRoundKey(state[:], w, Nr)
+
+	copy(dst, state[:])
+}
+
+// Decrypts one block without secret dependent lookups or branches, same output as DecryptBlock.
+func decryptBlockConstantTime(w []uint32, Nr int, dst, src []byte) {
+	var state [blockSize]byte
+	copy(state[:], src)
+
+	addRoundKey(state[:], w, Nr)
+	for round := Nr - 1; round > 0; round-- {
+		invShiftRows(state[:])
+		invSubBytesConstantTime(state[:])
+		addRoundKey(state[:], w, round)
+		invMixColumnsConstantTime(state[:])
+	}
+	invShiftRows(state[:])
+	invSubBytesConstantTime(state[:])
+	addRoundKey(state[:], w, 0)
+
+	copy(dst, state[:])
+}
+
+// Bytes replacement with the bitsliced S-box.
+func subBytesConstantTime(state []byte) {
+	unpackBitslice(state, sBoxBitsliced(packBitslice(state)))
+}
+
+// Bytes replacement inversion with the bitsliced inverse S-box.
+func invSubBytesConstantTime(state []byte) {
+	unpackBitslice(state, invSBoxBitsliced(packBitslice(state)))
+}
+
+// Applies the bitsliced S-box to each byte of the word, used by the constant time key expansion.
+func subWordConstantTime(word uint32) uint32 {
+	bytes := []byte{byte(word >> 24), byte(word >> 16), byte(word >> 8), byte(word)}
+	unpackBitslice(bytes, sBoxBitsliced(packBitslice(bytes)))
+	return uint32(bytes[0])<<24 | uint32(bytes[1])<<16 | uint32(bytes[2])<<8 | uint32(bytes[3])
+}
+
+// Rows shuffling with branch-free multiplication.
+func mixColumnsConstantTime(state []byte) {
+	for i := 0; i < 4; i++ {
+		idx := i * 4
+		a0, a1, a2, a3 := state[idx], state[idx+1], state[idx+2], state[idx+3]
+		state[idx+0] = gfMulConstantTime(a0, 2) ^ gfMulConstantTime(a1, 3) ^ a2 ^ a3
+		state[idx+1] = a0 ^ gfMulConstantTime(a1, 2) ^ gfMulConstantTime(a2, 3) ^ a3
+		state[idx+2] = a0 ^ a1 ^ gfMulConstantTime(a2, 2) ^ gfMulConstantTime(a3, 3)
+		state[idx+3] = gfMulConstantTime(a0, 3) ^ a1 ^ a2 ^ gfMulConstantTime(a3, 2)
+	}
+}
+
+// Inversion on shuffling rows with branch-free multiplication.
+func invMixColumnsConstantTime(state []byte) {
+	for i := 0; i < 4; i++ {
+		idx := i * 4
+		a0, a1, a2, a3 := state[idx], state[idx+1], state[idx+2], state[idx+3]
+		state[idx+0] = gfMulConstantTime(a0, 0x0e) ^ gfMulConstantTime(a1, 0x0b) ^ gfMulConstantTime(a2, 0x0d) ^ gfMulConstantTime(a3, 0x09)
+		state[idx+1] = gfMulConstantTime(a0, 0x09) ^ gfMulConstantTime(a1, 0x0e) ^ gfMulConstantTime(a2, 0x0b) ^ gfMulConstantTime(a3, 0x0d)
+		state[idx+2] = gfMulConstantTime(a0, 0x0d) ^ gfMulConstantTime(a1, 0x09) ^ gfMulConstantTime(a2, 0x0e) ^ gfMulConstantTime(a3, 0x0b)
+		state[idx+3] = gfMulConstantTime(a0, 0x0b) ^ gfMulConstantTime(a1, 0x0d) ^ gfMulConstantTime(a2, 0x09) ^ gfMulConstantTime(a3, 0x0e)
+	}
+}
+
+// Multiplication in GF(2^8) where bits of the operands only select masks, never branches.
+func gfMulConstantTime(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= a & -(b & 1)
+		a = a<<1 ^ 0x1b&-(a>>7)
+		b >>= 1
+	}
+	return p
+}
+
+// Transposes up to 16 bytes into bit planes.
+func packBitslice(data []byte) bitslice {
+	var planes bitslice
+	for i, value := range data {
+		for bit := 0; bit < 8; bit++ {
+			planes[bit] |= uint16(value>>bit&1) << i
+		}
+	}
+	return planes
+}
+
+// Transposes bit planes back into bytes.
+func unpackBitslice(data []byte, planes bitslice) {
+	for i := range data {
+		var value byte
+		for bit := 0; bit < 8; bit++ {
+			value |= byte(planes[bit]>>i&1) << bit
+		}
+		data[i] = value
+	}
+}
+
+// S-box: multiplicative inverse in GF(2^8) followed by the affine transformation.
+func sBoxBitsliced(x bitslice) bitslice {
+	inverse := bitslicedInverse(x)
+	var result bitslice
+	for i := 0; i < 8; i++ {
+		result[i] = inverse[i] ^ inverse[(i+4)%8] ^ inverse[(i+5)%8] ^ inverse[(i+6)%8] ^ inverse[(i+7)%8]
+		// Constant 0x63 is added to every byte.
+		result[i] ^= -uint16(0x63 >> i & 1)
+	}
+	return result
+}
+
+// Inverse S-box: inverse affine transformation followed by the multiplicative inverse.
+func invSBoxBitsliced(x bitslice) bitslice {
+	var affine bitslice
+	for i := 0; i < 8; i++ {
+		affine[i] = x[(i+2)%8] ^ x[(i+5)%8] ^ x[(i+7)%8]
+		// Constant 0x05 is added to every byte.
+		affine[i] ^= -uint16(0x05 >> i & 1)
+	}
+	return bitslicedInverse(affine)
+}
+
+// Computes x^254, which is the inverse of x in GF(2^8) and maps 0 to 0.
+func bitslicedInverse(x bitslice) bitslice {
+	x3 := bitslicedMul(bitslicedMul(x, x), x)
+	x7 := bitslicedMul(bitslicedMul(x3, x3), x)
+	x15 := bitslicedMul(bitslicedMul(x7, x7), x)
+	x31 := bitslicedMul(bitslicedMul(x15, x15), x)
+	x63 := bitslicedMul(bitslicedMul(x31, x31), x)
+	x127 := bitslicedMul(bitslicedMul(x63, x63), x)
+	return bitslicedMul(x127, x127)
+}
+
+// Multiplies all bytes pairwise in GF(2^8) using only AND and XOR on bit planes.
+func bitslicedMul(a, b bitslice) bitslice {
+	var product [15]uint16
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			product[i+j] ^= a[i] & b[j]
+		}
+	}
+	// Reduction modulo x^8 + x^4 + x^3 + x + 1.
+	for k := 14; k >= 8; k-- {
+		product[k-4] ^= product[k]
+		product[k-5] ^= product[k]
+		product[k-7] ^= product[k]
+		product[k-8] ^= product[k]
+	}
+	var result bitslice
+	copy(result[:], product[:8])
+	return result
+}
@@ -42,37 +42,49 @@ func DecryptBlock(input []byte, w []uint32, Nr int) []byte {
 	return state
 }
 
-func Encrypt(message string, key []byte, keySizeBits int) (string, error) {
-	data := ApplyPadding([]byte(message))
-	w, Nr, err := KeyExpansion(key, keySizeBits)
+// EncryptBytes encrypts data block by block with PKCS#7 padding.
+func EncryptBytes(data []byte, key []byte, keySizeBits int) ([]byte, error) {
+	block, err := newCipher(key, keySizeBits)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	var ciphertext []byte
-	for i := 0; i < len(data); i += blockSize {
-		block := data[i : i+blockSize]
-		encryptedBlock := EncryptBlock(block, w, Nr)
-		ciphertext = append(ciphertext, encryptedBlock...)
+	// Copy data, so padding never touches the caller's slice.
+	padded := ApplyPadding(append([]byte(nil), data...))
+	ciphertext := make([]byte, len(padded))
+	for i := 0; i < len(padded); i += blockSize {
+		block.Encrypt(ciphertext[i:], padded[i:])
 	}
-	return string(ciphertext), nil
+	return ciphertext, nil
 }
 
-func Decrypt(cipherText string, key []byte, keySizeBits int) (string, error) {
-	data := []byte(cipherText)
+// DecryptBytes decrypts data block by block and removes PKCS#7 padding.
+func DecryptBytes(data []byte, key []byte, keySizeBits int) ([]byte, error) {
 	if len(data)%blockSize != 0 {
-		return "", errors.New("incorrect length of ciphertext")
+		return nil, errors.New("incorrect length of ciphertext")
 	}
-	w, Nr, err := KeyExpansion(key, keySizeBits)
+	block, err := newCipher(key, keySizeBits)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	var plaintext []byte
+	plaintext := make([]byte, len(data))
 	for i := 0; i < len(data); i += blockSize {
-		block := data[i : i+blockSize]
-		decryptedBlock := DecryptBlock(block, w, Nr)
-		plaintext = append(plaintext, decryptedBlock...)
+		block.Decrypt(plaintext[i:], data[i:])
+	}
+	return RemovePadding(plaintext)
+}
+
+// Encrypt is a string wrapper over EncryptBytes, result holds raw binary ciphertext.
+func Encrypt(message string, key []byte, keySizeBits int) (string, error) {
+	ciphertext, err := EncryptBytes([]byte(message), key, keySizeBits)
+	if err != nil {
+		return "", err
 	}
-	plaintext, err = RemovePadding(plaintext)
+	return string(ciphertext), nil
+}
+
+// Decrypt is a string wrapper over DecryptBytes.
+func Decrypt(cipherText string, key []byte, keySizeBits int) (string, error) {
+	plaintext, err := DecryptBytes([]byte(cipherText), key, keySizeBits)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,48 @@
+package aes
+
+import "errors"
+
+// EncryptCTR encrypts data of any length in counter mode, iv is the initial 16 byte counter block.
+func EncryptCTR(data []byte, key []byte, keySizeBits int, iv []byte) ([]byte, error) {
+	return xorKeyStream(data, key, keySizeBits, iv)
+}
+
+// DecryptCTR decrypts data encrypted with EncryptCTR, it is the same operation as encryption.
+func DecryptCTR(data []byte, key []byte, keySizeBits int, iv []byte) ([]byte, error) {
+	return xorKeyStream(data, key, keySizeBits, iv)
+}
+
+// Xors data with the keystream produced by encrypting successive counter blocks.
+func xorKeyStream(data []byte, key []byte, keySizeBits int, iv []byte) ([]byte, error) {
+	if len(iv) != blockSize {
+		return nil, errors.New("incorrect length of IV")
+	}
+	block, err := newCipher(key, keySizeBits)
+	if err != nil {
+		return nil, err
+	}
+	counter := make([]byte, blockSize)
+	copy(counter, iv)
+	keyStream := make([]byte, blockSize)
+	output := make([]byte, len(data))
+	for i := 0; i < len(data); i += blockSize {
+		block.Encrypt(keyStream, counter)
+		end := i + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		xorBytes(output[i:end], data[i:end], keyStream)
+		incrementCounter(counter)
+	}
+	return output, nil
+}
+
+// Increments the counter block as a 128-bit big-endian number.
+func incrementCounter(counter []byte) {
+	for i := len(counter) - 1; i >= 0; i-- {
+		counter[i]++
+		if counter[i] != 0 {
+			return
+		}
+	}
+}
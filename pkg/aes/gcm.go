@@ -0,0 +1,176 @@
+package aes
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// GCMNonceSize is the only supported nonce size - 96 bits.
+const GCMNonceSize = 12
+
+// GCMTagSize is the size of the authentication tag - 128 bits.
+const GCMTagSize = 16
+
+// ErrTagMismatch is returned by OpenGCM when ciphertext or additional data were modified.
+var ErrTagMismatch = errors.New("message authentication failed: tag mismatch")
+
+// Element of GF(2^128), high holds the first 8 bytes of the block.
+type gcmFieldElement struct {
+	high, low uint64
+}
+
+// SealGCM encrypts and authenticates plaintext, authenticates additionalData and returns ciphertext with the tag appended.
+func SealGCM(plaintext []byte, key []byte, keySizeBits int, nonce []byte, additionalData []byte) ([]byte, error) {
+	block, err := newCipher(key, keySizeBits)
+	if err != nil {
+		return nil, err
+	}
+	return block.SealGCM(plaintext, nonce, additionalData)
+}
+
+// OpenGCM verifies the tag in constant time and decrypts output of SealGCM.
+func OpenGCM(ciphertext []byte, key []byte, keySizeBits int, nonce []byte, additionalData []byte) ([]byte, error) {
+	block, err := newCipher(key, keySizeBits)
+	if err != nil {
+		return nil, err
+	}
+	return block.OpenGCM(ciphertext, nonce, additionalData)
+}
+
+// SealGCM works like the package SealGCM with the already expanded key,
+// so callers sealing many messages with one key expand it only once.
+func (c *Cipher) SealGCM(plaintext, nonce, additionalData []byte) ([]byte, error) {
+	if len(nonce) != GCMNonceSize {
+		return nil, errors.New("incorrect length of nonce")
+	}
+	return gcmSeal(c, plaintext, nonce, additionalData), nil
+}
+
+// OpenGCM works like the package OpenGCM with the already expanded key.
+func (c *Cipher) OpenGCM(ciphertext, nonce, additionalData []byte) ([]byte, error) {
+	if len(nonce) != GCMNonceSize {
+		return nil, errors.New("incorrect length of nonce")
+	}
+	if len(ciphertext) < GCMTagSize {
+		return nil, errors.New("incorrect length of ciphertext")
+	}
+	return gcmOpen(c, ciphertext, nonce, additionalData)
+}
+
+// Seals plaintext with an already expanded key, nonce must be GCMNonceSize bytes.
+func gcmSeal(block *Cipher, plaintext, nonce, additionalData []byte) []byte {
+	h, counter := gcmInit(block, nonce)
+
+	ciphertext := make([]byte, len(plaintext), len(plaintext)+GCMTagSize)
+	gcmCounterCrypt(block, ciphertext, plaintext, counter)
+
+	tag := gcmTag(block, h, counter, additionalData, ciphertext)
+	return append(ciphertext, tag...)
+}
+
+// Opens output of gcmSeal, ciphertext must hold at least the tag.
+func gcmOpen(block *Cipher, ciphertext, nonce, additionalData []byte) ([]byte, error) {
+	h, counter := gcmInit(block, nonce)
+
+	tag := ciphertext[len(ciphertext)-GCMTagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-GCMTagSize]
+
+	expectedTag := gcmTag(block, h, counter, additionalData, ciphertext)
+	if subtle.ConstantTimeCompare(tag, expectedTag) != 1 {
+		return nil, ErrTagMismatch
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	gcmCounterCrypt(block, plaintext, ciphertext, counter)
+	return plaintext, nil
+}
+
+// Computes hash subkey H and the pre-counter block J0 for a 96-bit nonce.
+func gcmInit(block *Cipher, nonce []byte) (gcmFieldElement, []byte) {
+	hBlock := make([]byte, blockSize)
+	block.Encrypt(hBlock, hBlock)
+	h := gcmFieldElement{
+		high: binary.BigEndian.Uint64(hBlock[:8]),
+		low:  binary.BigEndian.Uint64(hBlock[8:]),
+	}
+	counter := make([]byte, blockSize)
+	copy(counter, nonce)
+	counter[blockSize-1] = 1
+	return h, counter
+}
+
+// Encrypts (or decrypts) src into dst starting from inc32(J0), J0 itself is left untouched.
+func gcmCounterCrypt(block *Cipher, dst, src []byte, j0 []byte) {
+	counter := make([]byte, blockSize)
+	copy(counter, j0)
+	keyStream := make([]byte, blockSize)
+	for i := 0; i < len(src); i += blockSize {
+		gcmIncrement32(counter)
+		block.Encrypt(keyStream, counter)
+		end := i + blockSize
+		if end > len(src) {
+			end = len(src)
+		}
+		xorBytes(dst[i:end], src[i:end], keyStream)
+	}
+}
+
+// Computes the tag - E(K, J0) xor GHASH(A, C).
+func gcmTag(block *Cipher, h gcmFieldElement, j0 []byte, additionalData, ciphertext []byte) []byte {
+	var y gcmFieldElement
+	y = ghashUpdate(h, y, additionalData)
+	y = ghashUpdate(h, y, ciphertext)
+	// Final block holds bit lengths of additional data and ciphertext.
+	y.high ^= uint64(len(additionalData)) * 8
+	y.low ^= uint64(len(ciphertext)) * 8
+	y = gfMul128(y, h)
+
+	tag := make([]byte, GCMTagSize)
+	binary.BigEndian.PutUint64(tag[:8], y.high)
+	binary.BigEndian.PutUint64(tag[8:], y.low)
+	encryptedJ0 := make([]byte, blockSize)
+	block.Encrypt(encryptedJ0, j0)
+	xorBytes(tag, tag, encryptedJ0)
+	return tag
+}
+
+// Absorbs data into GHASH state, the last partial block is padded with zeros.
+func ghashUpdate(h, y gcmFieldElement, data []byte) gcmFieldElement {
+	for i := 0; i < len(data); i += blockSize {
+		var block [blockSize]byte
+		copy(block[:], data[i:])
+		y.high ^= binary.BigEndian.Uint64(block[:8])
+		y.low ^= binary.BigEndian.Uint64(block[8:])
+		y = gfMul128(y, h)
+	}
+	return y
+}
+
+// Multiplication in GF(2^128) with the GCM polynomial x^128 + x^7 + x^2 + x + 1, without branches on data.
+func gfMul128(x, y gcmFieldElement) gcmFieldElement {
+	var z gcmFieldElement
+	v := y
+	for i := 0; i < 128; i++ {
+		var bit uint64
+		if i < 64 {
+			bit = (x.high >> (63 - i)) & 1
+		} else {
+			bit = (x.low >> (127 - i)) & 1
+		}
+		z.high ^= v.high & -bit
+		z.low ^= v.low & -bit
+
+		// Multiply v by x, bits are reflected so it is a right shift.
+		lsb := v.low & 1
+		v.low = v.low>>1 | v.high<<63
+		v.high = v.high>>1 ^ 0xe100000000000000&-lsb
+	}
+	return z
+}
+
+// Increments the rightmost 32 bits of the counter block.
+func gcmIncrement32(counter []byte) {
+	value := binary.BigEndian.Uint32(counter[blockSize-4:])
+	binary.BigEndian.PutUint32(counter[blockSize-4:], value+1)
+}
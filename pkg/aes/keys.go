@@ -1,23 +1,27 @@
 package aes
 
 import (
+	"crypto/rand"
 	"errors"
-	"math/rand"
-	"time"
+	"fmt"
+	"io"
 )
 
+// GenerateRandomKey generates a key using the operating system CSPRNG.
 func GenerateRandomKey(keySizeBits int) ([]byte, error) {
+	return GenerateKey(rand.Reader, keySizeBits)
+}
+
+// GenerateKey reads a key from the given entropy source, it has to be cryptographically secure.
+func GenerateKey(random io.Reader, keySizeBits int) ([]byte, error) {
 	if keySizeBits != 128 && keySizeBits != 192 && keySizeBits != 256 {
 		return nil, errors.New("invalid key size; must be 128, 192, or 256 bits")
 	}
-	keySizeBytes := keySizeBits / 8
-	key := make([]byte, keySizeBytes)
-
-	// Create a new local random generator with a seed based on the current time.
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	key := make([]byte, keySizeBits/8)
 
-	for i := 0; i < keySizeBytes; i++ {
-		key[i] = byte(r.Intn(256))
+	// A short read must fail too, otherwise part of the key stays zeroed.
+	if _, err := io.ReadFull(random, key); err != nil {
+		return nil, fmt.Errorf("failed to read key from entropy source: %w", err)
 	}
 	return key, nil
 }
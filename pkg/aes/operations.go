@@ -111,6 +111,11 @@ func addRoundKey(state []byte, w []uint32, round int) {
 
 // KeyExpansion generates a key extension for AES. Also validates key size.
 func KeyExpansion(key []byte, keySizeBits int) ([]uint32, int, error) {
+	return expandKey(key, keySizeBits, subWord)
+}
+
+// Key expansion with a pluggable S-box word substitution, so constant time core can avoid table lookups.
+func expandKey(key []byte, keySizeBits int, subWord func(uint32) uint32) ([]uint32, int, error) {
 	// Ensure the provided key length matches keySizeBits.
 	if len(key)*8 != keySizeBits {
 		return nil, 0, errors.New("key length does not match keySizeBits")
@@ -149,3 +154,10 @@ func KeyExpansion(key []byte, keySizeBits int) ([]uint32, int, error) {
 	}
 	return w, Nr, nil
 }
+
+// Xors a and b into dst, all slices must be of the same length.
+func xorBytes(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
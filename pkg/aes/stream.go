@@ -0,0 +1,317 @@
+package aes
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Stream container layout, all integers are big-endian:
+//
+//	magic "CYAS" | version (1) | mode (1) | key ID length (1) | key ID | nonce prefix (7) | chunk size (4) | chunks
+//
+// Every chunk is chunk size bytes of plaintext sealed with AES-GCM, only the final chunk may be shorter
+// or even empty. Chunk nonce is nonce prefix | chunk index (4) | final flag (1) and the whole header is
+// additional data of every chunk, so modified headers, reordered, dropped or appended chunks fail
+// authentication and a stream cut at a chunk boundary is reported as truncated.
+var streamMagic = []byte("CYAS")
+
+const (
+	// StreamVersion is the current stream container version.
+	StreamVersion = 1
+	// StreamModeGCM is the only stream mode, chunks are sealed with AES-GCM.
+	StreamModeGCM = 1
+	// DefaultChunkSize is used by NewStreamWriter when chunk size is zero.
+	DefaultChunkSize = 64 * 1024
+	// MaxChunkSize limits memory a reader allocates for a chunk.
+	MaxChunkSize = 16 * 1024 * 1024
+)
+
+// Random prefix makes nonces unique across streams encrypted with the same key.
+const streamNoncePrefixSize = 7
+
+// ErrStreamTruncated is returned when stream ends before its final chunk.
+var ErrStreamTruncated = errors.New("stream is truncated")
+
+// StreamHeader describes a stream, it is readable before decryption.
+type StreamHeader struct {
+	Version     byte
+	Mode        byte
+	KeyID       string
+	NoncePrefix []byte
+	ChunkSize   int
+}
+
+// StreamWriter encrypts everything written to it into chunks, Close must be called to write the final chunk.
+type StreamWriter struct {
+	w       io.Writer
+	block   *Cipher
+	header  StreamHeader
+	encoded []byte
+	buffer  []byte
+	index   uint32
+	closed  bool
+	err     error
+}
+
+// NewStreamWriter writes stream header to w and returns writer encrypting data with key.
+// Key ID is stored in the header as is, so readers can pick a key. Zero chunk size means DefaultChunkSize.
+func NewStreamWriter(w io.Writer, key []byte, keyID string, chunkSize int) (*StreamWriter, error) {
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize < 0 || chunkSize > MaxChunkSize {
+		return nil, fmt.Errorf("chunk size must be between 1 and %d", MaxChunkSize)
+	}
+	if len(keyID) > 255 {
+		return nil, errors.New("key ID is longer than 255 bytes")
+	}
+	block, err := NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	noncePrefix := make([]byte, streamNoncePrefixSize)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return nil, err
+	}
+
+	header := StreamHeader{
+		Version:     StreamVersion,
+		Mode:        StreamModeGCM,
+		KeyID:       keyID,
+		NoncePrefix: noncePrefix,
+		ChunkSize:   chunkSize,
+	}
+	encoded := header.encode()
+	if _, err := w.Write(encoded); err != nil {
+		return nil, err
+	}
+
+	return &StreamWriter{
+		w:       w,
+		block:   block,
+		header:  header,
+		encoded: encoded,
+		buffer:  make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// Header returns header written to the stream.
+func (s *StreamWriter) Header() StreamHeader {
+	return s.header
+}
+
+// Write buffers p and writes every full chunk which is known not to be the final one.
+func (s *StreamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("write to closed stream")
+	}
+	written := 0
+	for len(p) > 0 {
+		if s.err != nil {
+			return written, s.err
+		}
+		// Full buffer is sealed only when more data follows, otherwise it may be the final chunk.
+		if len(s.buffer) == s.header.ChunkSize {
+			s.err = s.sealChunk(false)
+			continue
+		}
+		n := copy(s.buffer[len(s.buffer):s.header.ChunkSize], p)
+		s.buffer = s.buffer[:len(s.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close writes the final chunk. It does not close the underlying writer.
+func (s *StreamWriter) Close() error {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	if s.err != nil {
+		return s.err
+	}
+	s.err = s.sealChunk(true)
+	return s.err
+}
+
+func (s *StreamWriter) sealChunk(final bool) error {
+	if s.index == ^uint32(0) {
+		return errors.New("stream has too many chunks")
+	}
+	ciphertext := gcmSeal(s.block, s.buffer, s.header.chunkNonce(s.index, final), s.encoded)
+	if _, err := s.w.Write(ciphertext); err != nil {
+		return err
+	}
+	s.buffer = s.buffer[:0]
+	s.index++
+	return nil
+}
+
+// StreamReader decrypts stream written by StreamWriter, chunk by chunk.
+type StreamReader struct {
+	r       *bufio.Reader
+	block   *Cipher
+	header  StreamHeader
+	encoded []byte
+	chunk   []byte
+	pending []byte
+	index   uint32
+	done    bool
+	err     error
+}
+
+// NewStreamReader reads stream header from r and returns reader decrypting the stream with key.
+func NewStreamReader(r io.Reader, key []byte) (*StreamReader, error) {
+	return NewStreamReaderWithKeyLookup(r, func(string) ([]byte, error) {
+		return key, nil
+	})
+}
+
+// NewStreamReaderWithKeyLookup reads stream header from r and decrypts the stream with key
+// returned by lookup for the key ID from the header.
+func NewStreamReaderWithKeyLookup(r io.Reader, lookup func(keyID string) ([]byte, error)) (*StreamReader, error) {
+	buffered := bufio.NewReader(r)
+	header, encoded, err := readStreamHeader(buffered)
+	if err != nil {
+		return nil, err
+	}
+	key, err := lookup(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamReader{
+		r:       buffered,
+		block:   block,
+		header:  header,
+		encoded: encoded,
+		chunk:   make([]byte, header.ChunkSize+GCMTagSize),
+	}, nil
+}
+
+// Header returns header read from the stream.
+func (s *StreamReader) Header() StreamHeader {
+	return s.header
+}
+
+// Read returns decrypted data, only data of authenticated chunks is ever returned.
+// io.EOF is returned after the final chunk, every error is permanent.
+func (s *StreamReader) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.err = s.openChunk()
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *StreamReader) openChunk() error {
+	n, err := io.ReadFull(s.r, s.chunk)
+	final := false
+	switch {
+	case errors.Is(err, io.EOF):
+		return ErrStreamTruncated
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// Only the final chunk is shorter than chunk size.
+		final = true
+	case err != nil:
+		return err
+	default:
+		_, err := s.r.Peek(1)
+		if errors.Is(err, io.EOF) {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if n < GCMTagSize {
+		return ErrStreamTruncated
+	}
+
+	plaintext, err := gcmOpen(s.block, s.chunk[:n], s.header.chunkNonce(s.index, final), s.encoded)
+	if err != nil {
+		// Chunk which opens as non-final shows the stream was cut after it.
+		if final {
+			if _, notFinalErr := gcmOpen(s.block, s.chunk[:n], s.header.chunkNonce(s.index, false), s.encoded); notFinalErr == nil {
+				return ErrStreamTruncated
+			}
+		}
+		return err
+	}
+	if s.index == ^uint32(0) && !final {
+		return errors.New("stream has too many chunks")
+	}
+
+	s.pending = plaintext
+	s.done = final
+	s.index++
+	return nil
+}
+
+func (h StreamHeader) encode() []byte {
+	encoded := make([]byte, 0, len(streamMagic)+3+len(h.KeyID)+len(h.NoncePrefix)+4)
+	encoded = append(encoded, streamMagic...)
+	encoded = append(encoded, h.Version, h.Mode, byte(len(h.KeyID)))
+	encoded = append(encoded, h.KeyID...)
+	encoded = append(encoded, h.NoncePrefix...)
+	return binary.BigEndian.AppendUint32(encoded, uint32(h.ChunkSize))
+}
+
+func readStreamHeader(r io.Reader) (StreamHeader, []byte, error) {
+	fixed := make([]byte, len(streamMagic)+3)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return StreamHeader{}, nil, fmt.Errorf("cannot read stream header: %w", err)
+	}
+	if string(fixed[:len(streamMagic)]) != string(streamMagic) {
+		return StreamHeader{}, nil, errors.New("not an encrypted stream")
+	}
+	header := StreamHeader{Version: fixed[len(streamMagic)], Mode: fixed[len(streamMagic)+1]}
+	if header.Version != StreamVersion {
+		return StreamHeader{}, nil, fmt.Errorf("unsupported stream version %d", header.Version)
+	}
+	if header.Mode != StreamModeGCM {
+		return StreamHeader{}, nil, fmt.Errorf("unsupported stream mode %d", header.Mode)
+	}
+
+	rest := make([]byte, int(fixed[len(streamMagic)+2])+streamNoncePrefixSize+4)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return StreamHeader{}, nil, fmt.Errorf("cannot read stream header: %w", err)
+	}
+	keyIDLength := len(rest) - streamNoncePrefixSize - 4
+	header.KeyID = string(rest[:keyIDLength])
+	header.NoncePrefix = rest[keyIDLength : keyIDLength+streamNoncePrefixSize]
+	chunkSize := binary.BigEndian.Uint32(rest[keyIDLength+streamNoncePrefixSize:])
+	if chunkSize == 0 || chunkSize > MaxChunkSize {
+		return StreamHeader{}, nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	header.ChunkSize = int(chunkSize)
+
+	return header, append(fixed, rest...), nil
+}
+
+// Chunk nonce is nonce prefix | chunk index | final flag.
+func (h StreamHeader) chunkNonce(index uint32, final bool) []byte {
+	nonce := make([]byte, GCMNonceSize)
+	copy(nonce, h.NoncePrefix)
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefixSize:], index)
+	if final {
+		nonce[GCMNonceSize-1] = 1
+	}
+	return nonce
+}
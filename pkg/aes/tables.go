@@ -0,0 +1,102 @@
+package aes
+
+import "encoding/binary"
+
+// T-tables combine SubBytes and MixColumns of one round into lookups on uint32 columns.
+// te1..te3 and td1..td3 are rotations of te0 and td0, they are kept to avoid rotations in the rounds.
+var te0, te1, te2, te3 [256]uint32
+var td0, td1, td2, td3 [256]uint32
+
+func init() {
+	for i := 0; i < 256; i++ {
+		s := sBox[i]
+		column := uint32(gfMul(s, 2))<<24 | uint32(s)<<16 | uint32(s)<<8 | uint32(gfMul(s, 3))
+		te0[i] = column
+		te1[i] = column>>8 | column<<24
+		te2[i] = column>>16 | column<<16
+		te3[i] = column>>24 | column<<8
+
+		s = invSBox[i]
+		column = uint32(gfMul(s, 0x0e))<<24 | uint32(gfMul(s, 0x09))<<16 | uint32(gfMul(s, 0x0d))<<8 | uint32(gfMul(s, 0x0b))
+		td0[i] = column
+		td1[i] = column>>8 | column<<24
+		td2[i] = column>>16 | column<<16
+		td3[i] = column>>24 | column<<8
+	}
+}
+
+// Builds the key schedule for the equivalent inverse cipher: round keys in reverse order,
+// with InvMixColumns applied to all of them except the first and the last.
+func expandDecryptionKey(w []uint32) []uint32 {
+	n := len(w)
+	dw := make([]uint32, n)
+	for i := 0; i < n; i += 4 {
+		ei := n - i - 4
+		for j := 0; j < 4; j++ {
+			word := w[ei+j]
+			if i > 0 && i+4 < n {
+				word = td0[sBox[word>>24]] ^ td1[sBox[word>>16&0xff]] ^ td2[sBox[word>>8&0xff]] ^ td3[sBox[word&0xff]]
+			}
+			dw[i+j] = word
+		}
+	}
+	return dw
+}
+
+// Encrypts one block with T-tables, produces the same output as EncryptBlock.
+func encryptBlockTables(w []uint32, Nr int, dst, src []byte) {
+	s0 := binary.BigEndian.Uint32(src[0:4]) ^ w[0]
+	s1 := binary.BigEndian.Uint32(src[4:8]) ^ w[1]
+	s2 := binary.BigEndian.Uint32(src[8:12]) ^ w[2]
+	s3 := binary.BigEndian.Uint32(src[12:16]) ^ w[3]
+
+	k := 4
+	for round := 1; round < Nr; round++ {
+		t0 := te0[s0>>24] ^ te1[s1>>16&0xff] ^ te2[s2>>8&0xff] ^ te3[s3&0xff] ^ w[k]
+		t1 := te0[s1>>24] ^ te1[s2>>16&0xff] ^ te2[s3>>8&0xff] ^ te3[s0&0xff] ^ w[k+1]
+		t2 := te0[s2>>24] ^ te1[s3>>16&0xff] ^ te2[s0>>8&0xff] ^ te3[s1&0xff] ^ w[k+2]
+		t3 := te0[s3>>24] ^ te1[s0>>16&0xff] ^ te2[s1>>8&0xff] ^ te3[s2&0xff] ^ w[k+3]
+		s0, s1, s2, s3 = t0, t1, t2, t3
+		k += 4
+	}
+
+	// Last round has no MixColumns.
+	t0 := uint32(sBox[s0>>24])<<24 | uint32(sBox[s1>>16&0xff])<<16 | uint32(sBox[s2>>8&0xff])<<8 | uint32(sBox[s3&0xff])
+	t1 := uint32(sBox[s1>>24])<<24 | uint32(sBox[s2>>16&0xff])<<16 | uint32(sBox[s3>>8&0xff])<<8 | uint32(sBox[s0&0xff])
+	t2 := uint32(sBox[s2>>24])<<24 | uint32(sBox[s3>>16&0xff])<<16 | uint32(sBox[s0>>8&0xff])<<8 | uint32(sBox[s1&0xff])
+	t3 := uint32(sBox[s3>>24])<<24 | uint32(sBox[s0>>16&0xff])<<16 | uint32(sBox[s1>>8&0xff])<<8 | uint32(sBox[s2&0xff])
+
+	binary.BigEndian.PutUint32(dst[0:4], t0^w[k])
+	binary.BigEndian.PutUint32(dst[4:8], t1^w[k+1])
+	binary.BigEndian.PutUint32(dst[8:12], t2^w[k+2])
+	binary.BigEndian.PutUint32(dst[12:16], t3^w[k+3])
+}
+
+// Decrypts one block with T-tables and the schedule from expandDecryptionKey, same output as DecryptBlock.
+func decryptBlockTables(dw []uint32, Nr int, dst, src []byte) {
+	s0 := binary.BigEndian.Uint32(src[0:4]) ^ dw[0]
+	s1 := binary.BigEndian.Uint32(src[4:8]) ^ dw[1]
+	s2 := binary.BigEndian.Uint32(src[8:12]) ^ dw[2]
+	s3 := binary.BigEndian.Uint32(src[12:16]) ^ dw[3]
+
+	k := 4
+	for round := 1; round < Nr; round++ {
+		t0 := td0[s0>>24] ^ td1[s3>>16&0xff] ^ td2[s2>>8&0xff] ^ td3[s1&0xff] ^ dw[k]
+		t1 := td0[s1>>24] ^ td1[s0>>16&0xff] ^ td2[s3>>8&0xff] ^ td3[s2&0xff] ^ dw[k+1]
+		t2 := td0[s2>>24] ^ td1[s1>>16&0xff] ^ td2[s0>>8&0xff] ^ td3[s3&0xff] ^ dw[k+2]
+		t3 := td0[s3>>24] ^ td1[s2>>16&0xff] ^ td2[s1>>8&0xff] ^ td3[s0&0xff] ^ dw[k+3]
+		s0, s1, s2, s3 = t0, t1, t2, t3
+		k += 4
+	}
+
+	// Last round has no InvMixColumns.
+	t0 := uint32(invSBox[s0>>24])<<24 | uint32(invSBox[s3>>16&0xff])<<16 | uint32(invSBox[s2>>8&0xff])<<8 | uint32(invSBox[s1&0xff])
+	t1 := uint32(invSBox[s1>>24])<<24 | uint32(invSBox[s0>>16&0xff])<<16 | uint32(invSBox[s3>>8&0xff])<<8 | uint32(invSBox[s2&0xff])
+	t2 := uint32(invSBox[s2>>24])<<24 | uint32(invSBox[s1>>16&0xff])<<16 | uint32(invSBox[s0>>8&0xff])<<8 | uint32(invSBox[s3&0xff])
+	t3 := uint32(invSBox[s3>>24])<<24 | uint32(invSBox[s2>>16&0xff])<<16 | uint32(invSBox[s1>>8&0xff])<<8 | uint32(invSBox[s0&0xff])
+
+	binary.BigEndian.PutUint32(dst[0:4], t0^dw[k])
+	binary.BigEndian.PutUint32(dst[4:8], t1^dw[k+1])
+	binary.BigEndian.PutUint32(dst[8:12], t2^dw[k+2])
+	binary.BigEndian.PutUint32(dst[12:16], t3^dw[k+3])
+}
@@ -0,0 +1,220 @@
+package channel
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/aes"
+	"io"
+	"net"
+	"sync"
+)
+
+// Record layout, all integers are big-endian:
+//
+//	type (1) | sequence number (8) | ciphertext length (4) | AES-256-GCM ciphertext with tag
+//
+// Nonce is the direction's 4-byte prefix followed by the sequence number, the 13-byte record
+// header is authenticated as additional data. Each direction counts records from zero, so any
+// dropped, replayed or reordered record has an unexpected sequence number.
+const (
+	recordFinished byte = 1
+	recordData     byte = 2
+	recordClose    byte = 3
+)
+
+const (
+	recordHeaderSize = 1 + 8 + 4
+	// MaxRecordSize is the largest plaintext carried by one record, longer writes are split.
+	MaxRecordSize = 1 << 14
+)
+
+var (
+	// ErrReplay is returned when a record arrives with an unexpected sequence number.
+	ErrReplay = errors.New("channel: replayed, reordered or dropped record")
+	// ErrTruncated is returned when the connection ends without a close record.
+	ErrTruncated = errors.New("channel: connection closed without close record")
+	// ErrClosed is returned by Write after Close.
+	ErrClosed = errors.New("channel: closed")
+)
+
+// Conn is an encrypted channel established by Client or Server. Read and Write may be called
+// concurrently with each other, but not with themselves.
+type Conn struct {
+	conn net.Conn
+
+	writeMutex sync.Mutex
+	writeKeys  trafficKeys
+	writeSeq   uint64
+	writeErr   error
+
+	readMutex sync.Mutex
+	readKeys  trafficKeys
+	readSeq   uint64
+	readErr   error
+	pending   []byte
+}
+
+func newConn(conn net.Conn, writeKeys, readKeys trafficKeys) *Conn {
+	return &Conn{conn: conn, writeKeys: writeKeys, readKeys: readKeys}
+}
+
+// Read returns decrypted application data. After close record it returns io.EOF,
+// any integrity failure is permanent and returned by every following call.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	for len(c.pending) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+
+		recordType, plaintext, err := c.readRecord()
+
+		if err != nil {
+			c.readErr = err
+			return 0, err
+		}
+
+		switch recordType {
+		case recordData:
+			c.pending = plaintext
+		case recordClose:
+			c.readErr = io.EOF
+		default:
+			c.readErr = fmt.Errorf("channel: unexpected record type %d", recordType)
+		}
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+
+	return n, nil
+}
+
+// Write encrypts p into one or more records.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	written := 0
+
+	for written < len(p) {
+		chunk := p[written:min(len(p), written+MaxRecordSize)]
+
+		if err := c.writeRecordLocked(recordData, chunk); err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+	}
+
+	return written, nil
+}
+
+// Close sends close record, so the other side can tell the end of data from truncation,
+// and closes the underlying connection.
+func (c *Conn) Close() error {
+	c.writeMutex.Lock()
+	err := c.writeRecordLocked(recordClose, nil)
+	c.writeErr = ErrClosed
+	c.writeMutex.Unlock()
+
+	if closeErr := c.conn.Close(); err == nil || errors.Is(err, ErrClosed) {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (c *Conn) writeRecord(recordType byte, plaintext []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	return c.writeRecordLocked(recordType, plaintext)
+}
+
+func (c *Conn) writeRecordLocked(recordType byte, plaintext []byte) error {
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+
+	header := make([]byte, recordHeaderSize)
+	header[0] = recordType
+	binary.BigEndian.PutUint64(header[1:], c.writeSeq)
+	binary.BigEndian.PutUint32(header[9:], uint32(len(plaintext)+aes.GCMTagSize))
+
+	ciphertext, err := c.writeKeys.block.SealGCM(plaintext, c.writeKeys.nonce(c.writeSeq), header)
+
+	if err == nil {
+		_, err = c.conn.Write(append(header, ciphertext...))
+	}
+
+	if err != nil {
+		c.writeErr = err
+		return err
+	}
+
+	c.writeSeq++
+	return nil
+}
+
+func (c *Conn) readRecord() (byte, []byte, error) {
+	header := make([]byte, recordHeaderSize)
+
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, ErrTruncated
+		}
+		return 0, nil, err
+	}
+
+	if binary.BigEndian.Uint64(header[1:]) != c.readSeq {
+		return 0, nil, ErrReplay
+	}
+
+	length := binary.BigEndian.Uint32(header[9:])
+
+	if length < aes.GCMTagSize || length > MaxRecordSize+aes.GCMTagSize {
+		return 0, nil, fmt.Errorf("channel: invalid record length %d", length)
+	}
+
+	ciphertext := make([]byte, length)
+
+	if _, err := io.ReadFull(c.conn, ciphertext); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, ErrTruncated
+		}
+		return 0, nil, err
+	}
+
+	plaintext, err := c.readKeys.block.OpenGCM(ciphertext, c.readKeys.nonce(c.readSeq), header)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	c.readSeq++
+	return header[0], plaintext, nil
+}
+
+// Reads the first record of the other side and checks it proves the same handshake.
+func (c *Conn) readFinished(transcript []byte) error {
+	recordType, plaintext, err := c.readRecord()
+
+	if err != nil || recordType != recordFinished || subtle.ConstantTimeCompare(plaintext, transcript) != 1 {
+		return ErrHandshake
+	}
+
+	return nil
+}
+
+// Record nonce is the direction's prefix followed by the sequence number.
+func (k trafficKeys) nonce(seq uint64) []byte {
+	nonce := make([]byte, aes.GCMNonceSize)
+	copy(nonce, k.ivPrefix)
+	binary.BigEndian.PutUint64(nonce[ivPrefixSize:], seq)
+	return nonce
+}
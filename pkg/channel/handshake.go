@@ -0,0 +1,303 @@
+package channel
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/aes"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"io"
+	"math/big"
+	"net"
+)
+
+// Handshake messages, all integers are big-endian:
+//
+//	client hello:  magic "CYCH" | version (1) | client nonce (32)
+//	server hello:  version (1) | server nonce (32) | SPKI length (2) | server public key as SPKI DER
+//	key exchange:  wrapped secret length (2) | RSA-OAEP (SHA-256) encrypted secret (32)
+//
+// Client checks SHA-256 of the SPKI against the pinned fingerprint before wrapping the secret.
+// Both sides derive traffic keys with HKDF-SHA256 from the secret, salted with both nonces and bound
+// to the hash of all handshake messages, then exchange finished records holding the same hash.
+var magic = []byte("CYCH")
+
+// Version is the current protocol version.
+const Version = 1
+
+const (
+	nonceSize     = 32
+	secretSize    = 32
+	keySize       = 32
+	ivPrefixSize  = 4
+	maxSPKISize   = 4096
+	maxWrapSize   = 1024
+	handshakeInfo = "cyphering channel v1"
+)
+
+// Label binds wrapped secrets to this protocol, so they cannot be reused in other OAEP protocols.
+var oaepLabel = []byte("cyphering channel")
+
+var (
+	// ErrFingerprintMismatch is returned by Client when server key is not the pinned one.
+	ErrFingerprintMismatch = errors.New("channel: server public key does not match pinned fingerprint")
+	// ErrHandshake is returned when the other side sends a malformed handshake or proves different keys.
+	ErrHandshake = errors.New("channel: handshake failed")
+)
+
+// Fingerprint returns SHA-256 of the public key encoded as SubjectPublicKeyInfo DER,
+// the same value as `openssl pkey -pubin -outform DER | sha256sum`.
+func Fingerprint(publicKey, N *big.Int) ([]byte, error) {
+	der, err := rsa.MarshalPKIXPublicKey(publicKey, N)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(der)
+	return sum[:], nil
+}
+
+// Client runs the handshake as a client and returns a channel over conn. Server public key must match
+// fingerprint returned by Fingerprint. Nil random means crypto/rand.Reader.
+// Conn is left open when the handshake fails.
+func Client(random io.Reader, conn net.Conn, fingerprint []byte) (*Conn, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+
+	clientHello := make([]byte, 0, len(magic)+1+nonceSize)
+	clientHello = append(clientHello, magic...)
+	clientHello = append(clientHello, Version)
+	clientNonce, err := readRandom(random, nonceSize)
+	if err != nil {
+		return nil, err
+	}
+	clientHello = append(clientHello, clientNonce...)
+
+	if _, err := conn.Write(clientHello); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 1+nonceSize+2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, handshakeError(err)
+	}
+	if header[0] != Version {
+		return nil, fmt.Errorf("%w: unsupported server version %d", ErrHandshake, header[0])
+	}
+	serverNonce := header[1 : 1+nonceSize]
+
+	spkiLength := binary.BigEndian.Uint16(header[1+nonceSize:])
+	if spkiLength == 0 || spkiLength > maxSPKISize {
+		return nil, fmt.Errorf("%w: invalid server key length %d", ErrHandshake, spkiLength)
+	}
+	spki := make([]byte, spkiLength)
+	if _, err := io.ReadFull(conn, spki); err != nil {
+		return nil, handshakeError(err)
+	}
+	serverHello := append(header, spki...)
+
+	sum := sha256.Sum256(spki)
+	if subtle.ConstantTimeCompare(sum[:], fingerprint) != 1 {
+		return nil, ErrFingerprintMismatch
+	}
+
+	serverKeys, err := rsa.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrHandshake, err)
+	}
+
+	secret, err := readRandom(random, secretSize)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), random, secret, oaepLabel, serverKeys.PublicKey, serverKeys.N)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrHandshake, err)
+	}
+
+	keyExchange := binary.BigEndian.AppendUint16(nil, uint16(len(wrapped)))
+	keyExchange = append(keyExchange, wrapped...)
+
+	if _, err := conn.Write(keyExchange); err != nil {
+		return nil, err
+	}
+
+	transcript := transcriptHash(clientHello, serverHello, keyExchange)
+	clientKeys, serverKeysMaterial, err := deriveKeys(secret, clientNonce, serverNonce, transcript)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := newConn(conn, clientKeys, serverKeysMaterial)
+
+	if err := channel.writeRecord(recordFinished, transcript); err != nil {
+		return nil, err
+	}
+	if err := channel.readFinished(transcript); err != nil {
+		return nil, err
+	}
+
+	return channel, nil
+}
+
+// Server runs the handshake as a server with its RSA keys and returns a channel over conn.
+// Nil random means crypto/rand.Reader. Conn is left open when the handshake fails.
+func Server(random io.Reader, conn net.Conn, keys *rsa.Keys) (*Conn, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+
+	spki, err := rsa.MarshalPKIXPublicKey(keys.PublicKey, keys.N)
+	if err != nil {
+		return nil, err
+	}
+
+	clientHello := make([]byte, len(magic)+1+nonceSize)
+	if _, err := io.ReadFull(conn, clientHello); err != nil {
+		return nil, handshakeError(err)
+	}
+	if subtle.ConstantTimeCompare(clientHello[:len(magic)], magic) != 1 {
+		return nil, fmt.Errorf("%w: invalid client hello", ErrHandshake)
+	}
+	if version := clientHello[len(magic)]; version != Version {
+		return nil, fmt.Errorf("%w: unsupported client version %d", ErrHandshake, version)
+	}
+	clientNonce := clientHello[len(magic)+1:]
+
+	serverNonce, err := readRandom(random, nonceSize)
+	if err != nil {
+		return nil, err
+	}
+
+	serverHello := make([]byte, 0, 1+nonceSize+2+len(spki))
+	serverHello = append(serverHello, Version)
+	serverHello = append(serverHello, serverNonce...)
+	serverHello = binary.BigEndian.AppendUint16(serverHello, uint16(len(spki)))
+	serverHello = append(serverHello, spki...)
+
+	if _, err := conn.Write(serverHello); err != nil {
+		return nil, err
+	}
+
+	lengthPrefix := make([]byte, 2)
+	if _, err := io.ReadFull(conn, lengthPrefix); err != nil {
+		return nil, handshakeError(err)
+	}
+	wrappedLength := binary.BigEndian.Uint16(lengthPrefix)
+	if wrappedLength == 0 || wrappedLength > maxWrapSize {
+		return nil, fmt.Errorf("%w: invalid key exchange length %d", ErrHandshake, wrappedLength)
+	}
+	wrapped := make([]byte, wrappedLength)
+	if _, err := io.ReadFull(conn, wrapped); err != nil {
+		return nil, handshakeError(err)
+	}
+	keyExchange := append(lengthPrefix, wrapped...)
+
+	secret, err := rsa.DecryptOAEP(sha256.New(), random, wrapped, oaepLabel, keys)
+	if err != nil || len(secret) != secretSize {
+		return nil, ErrHandshake
+	}
+
+	transcript := transcriptHash(clientHello, serverHello, keyExchange)
+	clientKeys, serverKeys, err := deriveKeys(secret, clientNonce, serverNonce, transcript)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := newConn(conn, serverKeys, clientKeys)
+
+	if err := channel.readFinished(transcript); err != nil {
+		return nil, err
+	}
+	if err := channel.writeRecord(recordFinished, transcript); err != nil {
+		return nil, err
+	}
+
+	return channel, nil
+}
+
+// Expanded AES key and nonce prefix protecting records sent in one direction.
+// Key is expanded once during the handshake and reused by every record.
+type trafficKeys struct {
+	block    *aes.Cipher
+	ivPrefix []byte
+}
+
+// Derives keys for both directions with HKDF-SHA256.
+func deriveKeys(secret, clientNonce, serverNonce, transcript []byte) (trafficKeys, trafficKeys, error) {
+	salt := append(append([]byte{}, clientNonce...), serverNonce...)
+	info := append([]byte(handshakeInfo), transcript...)
+
+	material := hkdfExpand(hkdfExtract(salt, secret), info, 2*keySize+2*ivPrefixSize)
+
+	clientBlock, err := aes.NewCipher(material[:keySize])
+	if err != nil {
+		return trafficKeys{}, trafficKeys{}, err
+	}
+
+	serverBlock, err := aes.NewCipher(material[keySize : 2*keySize])
+	if err != nil {
+		return trafficKeys{}, trafficKeys{}, err
+	}
+
+	client := trafficKeys{block: clientBlock, ivPrefix: material[2*keySize : 2*keySize+ivPrefixSize]}
+	server := trafficKeys{block: serverBlock, ivPrefix: material[2*keySize+ivPrefixSize:]}
+
+	return client, server, nil
+}
+
+// HKDF-Extract from RFC 5869.
+func hkdfExtract(salt, secret []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// HKDF-Expand from RFC 5869, length must not exceed 255 hash lengths.
+func hkdfExpand(prk, info []byte, length int) []byte {
+	mac := hmac.New(sha256.New, prk)
+	output := make([]byte, 0, length+sha256.Size)
+	var previous []byte
+
+	for counter := byte(1); len(output) < length; counter++ {
+		mac.Reset()
+		mac.Write(previous)
+		mac.Write(info)
+		mac.Write([]byte{counter})
+		previous = mac.Sum(nil)
+		output = append(output, previous...)
+	}
+
+	return output[:length]
+}
+
+func transcriptHash(messages ...[]byte) []byte {
+	hash := sha256.New()
+	for _, message := range messages {
+		hash.Write(message)
+	}
+	return hash.Sum(nil)
+}
+
+func readRandom(random io.Reader, size int) ([]byte, error) {
+	buffer := make([]byte, size)
+	if _, err := io.ReadFull(random, buffer); err != nil {
+		return nil, fmt.Errorf("failed to read from entropy source: %w", err)
+	}
+	return buffer, nil
+}
+
+// Connection closed in the middle of the handshake is reported as handshake failure.
+func handshakeError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: connection closed", ErrHandshake)
+	}
+	return err
+}
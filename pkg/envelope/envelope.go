@@ -0,0 +1,126 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/aes"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"io"
+	"math/big"
+)
+
+// Envelope layout, all integers are big-endian:
+//
+//	magic "CYEV" | version (1) | AES key size in bytes (1) | wrapped key length (2) | wrapped key |
+//	GCM nonce (12) | AES-GCM ciphertext with tag
+//
+// AES key is wrapped with RSA-OAEP (SHA-256), the whole header is authenticated as GCM additional data.
+var magic = []byte("CYEV")
+
+// Version is the current envelope format version.
+const Version = 1
+
+// MinKeySize is the smallest RSA modulus in bits which can wrap an AES-128 key with OAEP (SHA-256):
+// 16 key bytes plus two hashes and two bytes of OAEP overhead. AES-256 needs at least 784 bits.
+// Smaller keys, like 32- or 64-bit ones, cannot use envelopes at all.
+const MinKeySize = (16 + 2*sha256.Size + 2) * 8
+
+// Label binds wrapped keys to envelopes, so they cannot be reused in other OAEP protocols.
+var oaepLabel = []byte("cyphering envelope")
+
+// Seal encrypts plaintext of any length for the owner of the RSA key, the modulus must have at least
+// MinKeySize bits. AES-256 is used when the modulus is large enough for OAEP to wrap it, otherwise AES-128.
+// Nil random means crypto/rand.Reader.
+func Seal(random io.Reader, plaintext []byte, publicKey, N *big.Int) ([]byte, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+
+	keySize, err := keySizeFor(N)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := aes.GenerateKey(random, keySize*8)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), random, key, oaepLabel, publicKey, N)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap AES key: %w", err)
+	}
+
+	nonce := make([]byte, aes.GCMNonceSize)
+	if _, err := io.ReadFull(random, nonce); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(magic)+4+len(wrappedKey)+len(nonce))
+	header = append(header, magic...)
+	header = append(header, Version, byte(keySize))
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+	header = append(header, nonce...)
+
+	ciphertext, err := aes.SealGCM(plaintext, key, keySize*8, nonce, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, ciphertext...), nil
+}
+
+// Open unwraps the AES key with RSA private key and decrypts the envelope. Random is used for blinding.
+func Open(random io.Reader, envelope []byte, keys *rsa.Keys) ([]byte, error) {
+	headerSize := len(magic) + 4
+
+	if len(envelope) < headerSize || string(envelope[:len(magic)]) != string(magic) {
+		return nil, errors.New("not an envelope")
+	}
+
+	if version := envelope[len(magic)]; version != Version {
+		return nil, errors.New(fmt.Sprintf("unsupported envelope version %d", version))
+	}
+
+	keySize := int(envelope[len(magic)+1])
+	wrappedKeyLength := int(binary.BigEndian.Uint16(envelope[len(magic)+2:]))
+
+	if len(envelope) < headerSize+wrappedKeyLength+aes.GCMNonceSize+aes.GCMTagSize {
+		return nil, errors.New("envelope is truncated")
+	}
+
+	wrappedKey := envelope[headerSize : headerSize+wrappedKeyLength]
+	nonce := envelope[headerSize+wrappedKeyLength : headerSize+wrappedKeyLength+aes.GCMNonceSize]
+	header := envelope[:headerSize+wrappedKeyLength+aes.GCMNonceSize]
+
+	key, err := rsa.DecryptOAEP(sha256.New(), random, wrappedKey, oaepLabel, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap AES key: %w", err)
+	}
+
+	if len(key) != keySize {
+		return nil, errors.New("unwrapped AES key has wrong size")
+	}
+
+	return aes.OpenGCM(envelope[len(header):], key, keySize*8, nonce, header)
+}
+
+// Picks the largest AES key size OAEP with SHA-256 can wrap with the modulus.
+func keySizeFor(N *big.Int) (int, error) {
+	if N.BitLen() < MinKeySize {
+		return 0, errors.New(fmt.Sprintf("RSA modulus of %d bit is too small to wrap an AES key, at least %d bit is required", N.BitLen(), MinKeySize))
+	}
+
+	// OAEP overhead is two hashes and two bytes.
+	capacity := (N.BitLen()+7)/8 - 2*sha256.Size - 2
+
+	if capacity >= 32 {
+		return 32, nil
+	}
+
+	return 16, nil
+}
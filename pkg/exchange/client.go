@@ -0,0 +1,154 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"net"
+	"sync"
+	"time"
+)
+
+// Client sends encrypted requests to a server after exchanging public keys with it.
+// It is safe for concurrent use, requests are sent one at a time.
+type Client struct {
+	conn       net.Conn
+	messages   *messageConn
+	keys       *rsa.Keys
+	serverKeys *rsa.Keys
+
+	mutex sync.Mutex
+}
+
+// Dial connects to server at address within DialTimeout and exchanges public keys. Trace may be nil.
+func Dial(address string, keys *rsa.Keys, trace Trace) (*Client, error) {
+	if err := checkClientKeys(keys); err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", address, DialTimeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClient(conn, keys, trace)
+
+	if err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// NewClient exchanges public keys over an established connection, server must answer within RequestTimeout.
+func NewClient(conn net.Conn, keys *rsa.Keys, trace Trace) (*Client, error) {
+	if err := checkClientKeys(keys); err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(RequestTimeout)); err != nil {
+		return nil, err
+	}
+
+	messages := newMessageConn(conn, trace)
+
+	if err := messages.send(publicKeyMessage(keys.PublicKey, keys.N)); err != nil {
+		return nil, err
+	}
+
+	message, err := messages.receive()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Type == TypeError {
+		return nil, fmt.Errorf("server rejected key exchange: %s", message.Error)
+	}
+
+	serverPublicKey, serverN, err := parsePublicKey(message)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn:       conn,
+		messages:   messages,
+		keys:       keys,
+		serverKeys: &rsa.Keys{PublicKey: serverPublicKey, N: serverN},
+	}, nil
+}
+
+// ServerKeys returns public key received from the server, private key is never known to the client.
+func (c *Client) ServerKeys() *rsa.Keys {
+	return c.serverKeys
+}
+
+// SendRaw sends text sealed with envelope.Seal and returns decrypted response text of any length.
+func (c *Client) SendRaw(text string) (string, error) {
+	return c.send(FormatRaw, text)
+}
+
+// SendJSON sends JSON document encrypted with rsa.EncryptStruct and returns decrypted response document.
+func (c *Client) SendJSON(document string) (string, error) {
+	return c.send(FormatJSON, document)
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) send(format, body string) (string, error) {
+	payload, err := encryptPayload(format, body, c.serverKeys.PublicKey, c.serverKeys.N)
+
+	if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.conn.SetDeadline(time.Now().Add(RequestTimeout)); err != nil {
+		return "", err
+	}
+
+	if err := c.messages.send(Message{Type: TypeRequest, Format: format, Payload: payload}); err != nil {
+		return "", err
+	}
+
+	response, err := c.messages.receive()
+
+	if err != nil {
+		return "", err
+	}
+
+	switch response.Type {
+	case TypeResponse:
+		if response.Format != format {
+			return "", fmt.Errorf("expected %s response, got %q", format, response.Format)
+		}
+
+		return decryptPayload(response.Format, response.Payload, c.keys)
+	case TypeError:
+		return "", fmt.Errorf("server error: %s", response.Error)
+	default:
+		return "", fmt.Errorf("unexpected %q message", response.Type)
+	}
+}
+
+// Server rejects keys it cannot encrypt responses for, so they are checked before connecting.
+func checkClientKeys(keys *rsa.Keys) error {
+	if keys == nil || keys.PrivateKey == nil || keys.PublicKey == nil || keys.N == nil {
+		return errors.New("client needs complete RSA keys")
+	}
+
+	return checkKeySize(keys.N)
+}
@@ -0,0 +1,271 @@
+package exchange
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/envelope"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"io"
+	"math/big"
+	"time"
+)
+
+// Every message is a single line of JSON. Exchange starts with both sides sending
+// their public keys, then client sends requests and server answers each of them:
+//
+//	-> {"type":"public_key","public_key":"65537","n":"..."}
+//	<- {"type":"public_key","public_key":"65537","n":"..."}
+//	-> {"type":"request","format":"raw","payload":"<hex ciphertext>"}
+//	<- {"type":"response","format":"raw","payload":"<hex ciphertext>"}
+//
+// Requests are encrypted with the server public key, responses with the client public key.
+// Raw payload is a hex string of envelope.Seal, the same format the GUI shows, so text of any length
+// can be sent. JSON payload is a document from rsa.EncryptStruct.
+const (
+	TypePublicKey = "public_key"
+	TypeRequest   = "request"
+	TypeResponse  = "response"
+	TypeError     = "error"
+)
+
+// Payload formats.
+const (
+	FormatRaw  = "raw"
+	FormatJSON = "json"
+)
+
+// DefaultAddress is the address server listens on and client connects to by default.
+const DefaultAddress = "localhost:7070"
+
+// Longest accepted message line, protects both sides from unbounded reads.
+const maxMessageSize = 1 << 20
+
+// MinKeySize is the smallest accepted RSA modulus in bits. JSON payloads encrypt every value with OAEP,
+// which leaves only 62 bytes per value with 1024-bit keys, so both sides must have at least that.
+const MinKeySize = 1024
+
+// Timeouts of both sides, so a silent peer never blocks a connection forever.
+const (
+	// DialTimeout limits connecting to the server.
+	DialTimeout = 5 * time.Second
+
+	// RequestTimeout limits key exchange and every request with its response.
+	RequestTimeout = 30 * time.Second
+
+	// IdleTimeout is how long server waits for the next request before closing the connection.
+	IdleTimeout = 5 * time.Minute
+)
+
+// Message is one line of the exchange protocol.
+type Message struct {
+	Type      string          `json:"type"`
+	Format    string          `json:"format,omitempty"`
+	PublicKey string          `json:"public_key,omitempty"`
+	N         string          `json:"n,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Trace is called with every line sent ("->") or received ("<-") on a connection.
+type Trace func(direction string, line string)
+
+// Reads and writes newline-delimited messages, reporting every line to trace.
+type messageConn struct {
+	reader *bufio.Reader
+	writer io.Writer
+	trace  Trace
+}
+
+func newMessageConn(conn io.ReadWriter, trace Trace) *messageConn {
+	return &messageConn{reader: bufio.NewReader(conn), writer: conn, trace: trace}
+}
+
+func (c *messageConn) send(message Message) error {
+	line, err := json.Marshal(message)
+
+	if err != nil {
+		return err
+	}
+
+	if c.trace != nil {
+		c.trace("->", string(line))
+	}
+
+	_, err = c.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (c *messageConn) receive() (Message, error) {
+	var line []byte
+
+	for {
+		chunk, isPrefix, err := c.reader.ReadLine()
+
+		if err != nil {
+			return Message{}, err
+		}
+
+		line = append(line, chunk...)
+
+		if len(line) > maxMessageSize {
+			return Message{}, errors.New("message is too long")
+		}
+
+		if !isPrefix {
+			break
+		}
+	}
+
+	if c.trace != nil {
+		c.trace("<-", string(line))
+	}
+
+	var message Message
+
+	if err := json.Unmarshal(line, &message); err != nil {
+		return Message{}, fmt.Errorf("malformed message: %w", err)
+	}
+
+	return message, nil
+}
+
+// Builds public key message in the same decimal form the GUI shows keys.
+func publicKeyMessage(publicKey, N *big.Int) Message {
+	return Message{Type: TypePublicKey, PublicKey: publicKey.Text(10), N: N.Text(10)}
+}
+
+// Parses public key of the other side, rejecting values which cannot be RSA keys or are too small.
+func parsePublicKey(message Message) (*big.Int, *big.Int, error) {
+	if message.Type != TypePublicKey {
+		return nil, nil, fmt.Errorf("expected %s message, got %q", TypePublicKey, message.Type)
+	}
+
+	publicKey, ok := new(big.Int).SetString(message.PublicKey, 10)
+
+	// Public exponent is coprime with the even (p-1)(q-1), so it is odd and at least 3.
+	if !ok || publicKey.Cmp(big.NewInt(3)) < 0 || publicKey.Bit(0) == 0 {
+		return nil, nil, errors.New("invalid public key")
+	}
+
+	N, ok := new(big.Int).SetString(message.N, 10)
+
+	// Modulus is a product of two odd primes.
+	if !ok || N.Cmp(publicKey) <= 0 || N.Bit(0) == 0 {
+		return nil, nil, errors.New("invalid modulus")
+	}
+
+	if err := checkKeySize(N); err != nil {
+		return nil, nil, err
+	}
+
+	return publicKey, N, nil
+}
+
+// Checks that payloads can be encrypted with the modulus.
+func checkKeySize(N *big.Int) error {
+	if N.BitLen() < MinKeySize {
+		return fmt.Errorf("%d-bit key is too small, keys of at least %d bits are required", N.BitLen(), MinKeySize)
+	}
+
+	return nil
+}
+
+// Encrypts body of given format for the owner of the public key.
+func encryptPayload(format, body string, publicKey, N *big.Int) (json.RawMessage, error) {
+	switch format {
+	case FormatRaw:
+		sealed, err := envelope.Seal(nil, []byte(body), publicKey, N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(hex.EncodeToString(sealed))
+	case FormatJSON:
+		document, err := decodeDocument([]byte(body))
+
+		if err != nil {
+			return nil, err
+		}
+
+		encrypted, err := rsa.EncryptStruct(document, publicKey, N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(encrypted)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// Decrypts payload of given format with private key and returns plaintext body.
+func decryptPayload(format string, payload json.RawMessage, keys *rsa.Keys) (string, error) {
+	switch format {
+	case FormatRaw:
+		var encrypted string
+
+		if err := json.Unmarshal(payload, &encrypted); err != nil {
+			return "", fmt.Errorf("raw payload must be a hex string: %w", err)
+		}
+
+		sealed, err := hex.DecodeString(encrypted)
+
+		if err != nil {
+			return "", fmt.Errorf("raw payload must be a hex string: %w", err)
+		}
+
+		opened, err := envelope.Open(nil, sealed, keys)
+
+		if err != nil {
+			return "", err
+		}
+
+		return string(opened), nil
+	case FormatJSON:
+		document, err := decodeDocument(payload)
+
+		if err != nil {
+			return "", err
+		}
+
+		decrypted, err := rsa.DecryptStruct(document, keys)
+
+		if err != nil {
+			return "", err
+		}
+
+		body, err := json.Marshal(decrypted)
+
+		if err != nil {
+			return "", err
+		}
+
+		return string(body), nil
+	default:
+		return "", fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// Decodes JSON keeping numbers as json.Number, so they survive encryption exactly.
+func decodeDocument(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document interface{}
+
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if decoder.More() {
+		return nil, errors.New("invalid JSON: more than one value")
+	}
+
+	return document, nil
+}
@@ -0,0 +1,162 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"time"
+)
+
+// Handler answers decrypted request body of given format with plaintext response body.
+type Handler func(format, body string) (string, error)
+
+// EchoHandler answers every request with its own body.
+func EchoHandler(format, body string) (string, error) {
+	return body, nil
+}
+
+// Server decrypts requests with its keys and encrypts handler responses with public key of each client.
+type Server struct {
+	keys    *rsa.Keys
+	handler Handler
+
+	// Logger receives connection events and protocol errors, nil disables logging.
+	Logger *log.Logger
+}
+
+func NewServer(keys *rsa.Keys, handler Handler) (*Server, error) {
+	if keys == nil || keys.PrivateKey == nil || keys.PublicKey == nil || keys.N == nil {
+		return nil, errors.New("server needs complete RSA keys")
+	}
+
+	if err := checkKeySize(keys.N); err != nil {
+		return nil, err
+	}
+
+	if handler == nil {
+		handler = EchoHandler
+	}
+
+	return &Server{keys: keys, handler: handler}, nil
+}
+
+// Serve accepts connections until listener is closed, each connection is served in its own goroutine.
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn runs the exchange on a single connection and closes it when client disconnects.
+// Key exchange must finish within RequestTimeout, connections idle for IdleTimeout are closed.
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	s.logf("%s connected", conn.RemoteAddr())
+
+	if err := s.serve(conn, newMessageConn(conn, nil)); err != nil && !errors.Is(err, io.EOF) {
+		s.logf("%s: %s", conn.RemoteAddr(), err)
+	}
+
+	s.logf("%s disconnected", conn.RemoteAddr())
+}
+
+func (s *Server) serve(conn net.Conn, messages *messageConn) error {
+	if err := conn.SetDeadline(time.Now().Add(RequestTimeout)); err != nil {
+		return err
+	}
+
+	message, err := messages.receive()
+
+	if err != nil {
+		return err
+	}
+
+	clientPublicKey, clientN, err := parsePublicKey(message)
+
+	if err != nil {
+		// Tells the client why, undersized keys are a common mistake.
+		_ = messages.send(Message{Type: TypeError, Error: err.Error()})
+
+		return err
+	}
+
+	if err := messages.send(publicKeyMessage(s.keys.PublicKey, s.keys.N)); err != nil {
+		return err
+	}
+
+	for {
+		if err := conn.SetDeadline(time.Now().Add(IdleTimeout)); err != nil {
+			return err
+		}
+
+		request, err := messages.receive()
+
+		if err != nil {
+			return err
+		}
+
+		// Response is computed and written within RequestTimeout after the request arrives.
+		if err := conn.SetWriteDeadline(time.Now().Add(RequestTimeout)); err != nil {
+			return err
+		}
+
+		response, err := s.respond(request, clientPublicKey, clientN)
+
+		if err != nil {
+			// Errors are reported to the client and the connection stays usable.
+			s.logf("request failed: %s", err)
+			response = Message{Type: TypeError, Error: err.Error()}
+		}
+
+		if err := messages.send(response); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) respond(request Message, clientPublicKey, clientN *big.Int) (Message, error) {
+	if request.Type != TypeRequest {
+		return Message{}, fmt.Errorf("expected %s message, got %q", TypeRequest, request.Type)
+	}
+
+	body, err := decryptPayload(request.Format, request.Payload, s.keys)
+
+	if err != nil {
+		return Message{}, fmt.Errorf("cannot decrypt request: %w", err)
+	}
+
+	responseBody, err := s.handler(request.Format, body)
+
+	if err != nil {
+		return Message{}, err
+	}
+
+	payload, err := encryptPayload(request.Format, responseBody, clientPublicKey, clientN)
+
+	if err != nil {
+		return Message{}, fmt.Errorf("cannot encrypt response: %w", err)
+	}
+
+	return Message{Type: TypeResponse, Format: request.Format, Payload: payload}, nil
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,272 @@
+package jwk
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/aes"
+	"github.com/mesiriak/cyphering/pkg/rsa"
+	"math/big"
+)
+
+// Key types from RFC 7518.
+const (
+	KeyTypeRSA = "RSA"
+	KeyTypeOct = "oct"
+)
+
+// Key is a JSON Web Key (RFC 7517) with RSA and symmetric members, all values are base64url without padding.
+type Key struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA members.
+	N  string `json:"n,omitempty"`
+	E  string `json:"e,omitempty"`
+	D  string `json:"d,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+
+	// Symmetric key member.
+	K string `json:"k,omitempty"`
+}
+
+// Set is a JWK Set.
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// FromRSAKeys converts keys to an RSA JWK, private members are included when keys have them.
+func FromRSAKeys(keys *rsa.Keys, kid string) (Key, error) {
+	if keys.PublicKey == nil || keys.N == nil {
+		return Key{}, errors.New("RSA public key and N are required")
+	}
+
+	key := Key{
+		Kty: KeyTypeRSA,
+		Kid: kid,
+		N:   encodeInt(keys.N),
+		E:   encodeInt(keys.PublicKey),
+	}
+
+	if keys.PrivateKey == nil {
+		return key, nil
+	}
+
+	key.D = encodeInt(keys.PrivateKey)
+
+	if keys.P == nil || keys.Q == nil {
+		return key, nil
+	}
+
+	// Copy is used, so missing CRT parameters are calculated without modifying caller's keys.
+	withCRT := *keys
+	if withCRT.DP == nil || withCRT.DQ == nil || withCRT.QInv == nil {
+		if err := withCRT.Precompute(); err != nil {
+			return Key{}, err
+		}
+	}
+
+	key.P = encodeInt(withCRT.P)
+	key.Q = encodeInt(withCRT.Q)
+	key.DP = encodeInt(withCRT.DP)
+	key.DQ = encodeInt(withCRT.DQ)
+	key.QI = encodeInt(withCRT.QInv)
+
+	return key, nil
+}
+
+// RSAKeys converts an RSA JWK to keys, public only JWK gives keys without PrivateKey.
+func (k Key) RSAKeys() (*rsa.Keys, error) {
+	if k.Kty != KeyTypeRSA {
+		return nil, errors.New(fmt.Sprintf("JWK has key type %q, expected %q", k.Kty, KeyTypeRSA))
+	}
+
+	keys := &rsa.Keys{}
+	members := []struct {
+		name     string
+		value    string
+		target   **big.Int
+		required bool
+	}{
+		{"n", k.N, &keys.N, true},
+		{"e", k.E, &keys.PublicKey, true},
+		{"d", k.D, &keys.PrivateKey, false},
+		{"p", k.P, &keys.P, false},
+		{"q", k.Q, &keys.Q, false},
+		{"dp", k.DP, &keys.DP, false},
+		{"dq", k.DQ, &keys.DQ, false},
+		{"qi", k.QI, &keys.QInv, false},
+	}
+
+	for _, member := range members {
+		if member.value == "" {
+			if member.required {
+				return nil, errors.New(fmt.Sprintf("JWK member %q is required", member.name))
+			}
+			continue
+		}
+
+		value, err := decodeInt(member.value)
+
+		if err != nil {
+			return nil, fmt.Errorf("JWK member %q: %w", member.name, err)
+		}
+
+		*member.target = value
+	}
+
+	if keys.PrivateKey == nil {
+		if keys.P != nil || keys.Q != nil || keys.DP != nil || keys.DQ != nil || keys.QInv != nil {
+			return nil, errors.New("JWK has private members without \"d\"")
+		}
+
+		return keys, nil
+	}
+
+	if keys.P != nil && keys.Q != nil && (keys.DP == nil || keys.DQ == nil || keys.QInv == nil) {
+		if err := keys.Precompute(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := keys.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid RSA JWK: %w", err)
+	}
+
+	return keys, nil
+}
+
+// FromAESKey converts AES key to a symmetric (oct) JWK.
+func FromAESKey(key []byte, kid string) (Key, error) {
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return Key{}, errors.New("invalid key size; must be 128, 192, or 256 bits")
+	}
+
+	return Key{
+		Kty: KeyTypeOct,
+		Kid: kid,
+		K:   base64.RawURLEncoding.EncodeToString(key),
+	}, nil
+}
+
+// AESKey converts a symmetric JWK to AES key, key size is checked by creating a cipher.
+func (k Key) AESKey() ([]byte, error) {
+	if k.Kty != KeyTypeOct {
+		return nil, errors.New(fmt.Sprintf("JWK has key type %q, expected %q", k.Kty, KeyTypeOct))
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(k.K)
+
+	if err != nil {
+		return nil, fmt.Errorf("JWK member \"k\": %w", err)
+	}
+
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Public returns the key without private members, symmetric keys have no public part.
+func (k Key) Public() (Key, error) {
+	if k.Kty != KeyTypeRSA {
+		return Key{}, errors.New("only RSA JWK has a public part")
+	}
+
+	return Key{Kty: k.Kty, Kid: k.Kid, Use: k.Use, Alg: k.Alg, N: k.N, E: k.E}, nil
+}
+
+// ParseKey decodes a single JWK.
+func ParseKey(data []byte) (Key, error) {
+	var key Key
+
+	if err := json.Unmarshal(data, &key); err != nil {
+		return Key{}, err
+	}
+
+	if key.Kty == "" {
+		return Key{}, errors.New("JWK member \"kty\" is required")
+	}
+
+	return key, nil
+}
+
+// ParseSet decodes a JWK Set.
+func ParseSet(data []byte) (*Set, error) {
+	var set Set
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	for i, key := range set.Keys {
+		if key.Kty == "" {
+			return nil, errors.New(fmt.Sprintf("JWK Set key %d: member \"kty\" is required", i))
+		}
+	}
+
+	return &set, nil
+}
+
+// Add appends key to the set, kid must be set and unique.
+func (s *Set) Add(key Key) error {
+	if key.Kid == "" {
+		return errors.New("JWK Set keys must have \"kid\"")
+	}
+
+	if _, err := s.Lookup(key.Kid); err == nil {
+		return errors.New(fmt.Sprintf("JWK Set already has key with kid %q", key.Kid))
+	}
+
+	s.Keys = append(s.Keys, key)
+
+	return nil
+}
+
+// Lookup finds the key with the given kid, ambiguous kid is an error.
+func (s *Set) Lookup(kid string) (Key, error) {
+	var found []Key
+
+	for _, key := range s.Keys {
+		if key.Kid == kid {
+			found = append(found, key)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return Key{}, errors.New(fmt.Sprintf("JWK Set has no key with kid %q", kid))
+	case 1:
+		return found[0], nil
+	default:
+		return Key{}, errors.New(fmt.Sprintf("JWK Set has %d keys with kid %q", len(found), kid))
+	}
+}
+
+// Encodes unsigned integer as base64url without leading zeros.
+func encodeInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+// Decodes base64url unsigned integer.
+func decodeInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes) == 0 {
+		return nil, errors.New("empty integer")
+	}
+
+	return new(big.Int).SetBytes(bytes), nil
+}
@@ -4,8 +4,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
-	"strconv"
 )
 
 func Encrypt(message string, publicKey, N *big.Int) (string, error) {
@@ -22,7 +22,14 @@ func Encrypt(message string, publicKey, N *big.Int) (string, error) {
 	return hex.EncodeToString(cipherText.Bytes()), nil
 }
 
-func Decrypt(cipherText string, privateKey, N *big.Int) (string, error) {
+// Decrypt decrypts output of Encrypt. Keys must hold public key, it is needed to blind the ciphertext.
+func Decrypt(cipherText string, keys *Keys) (string, error) {
+	return DecryptWithKeys(nil, cipherText, keys)
+}
+
+// DecryptWithKeys decrypts like Decrypt, but draws blinding randomness from random.
+// CRT parameters are used when keys have them.
+func DecryptWithKeys(random io.Reader, cipherText string, keys *Keys) (string, error) {
 	cipherTextBytes, err := hex.DecodeString(cipherText)
 
 	if err != nil {
@@ -32,90 +39,11 @@ func Decrypt(cipherText string, privateKey, N *big.Int) (string, error) {
 	cipherTextNumber := new(big.Int).SetBytes(cipherTextBytes)
 
 	// Perform cipherTextNumber ^ privateKey % N (RSA decryption).
-	message := new(big.Int).Exp(cipherTextNumber, privateKey, N)
-
-	return bigIntToString(message), nil
-}
-
-func EncryptStruct(json interface{}, publicKey, N *big.Int) (interface{}, error) {
-	switch v := json.(type) {
-	case string:
-		return Encrypt(v, publicKey, N)
-	case int:
-		return Encrypt(strconv.Itoa(v), publicKey, N)
-	case float64:
-		return Encrypt(strconv.FormatFloat(v, 'f', -1, 64), publicKey, N)
-	case []interface{}:
-		// For lists, recursively encrypt each item
-		encryptedList := make([]interface{}, len(v))
-		for i, item := range v {
-			encrypted, err := EncryptStruct(item, publicKey, N)
-
-			if err != nil {
-				return nil, err
-			}
-
-			encryptedList[i] = encrypted
-		}
-		return encryptedList, nil
-	case map[string]interface{}:
-		// For objects, recursively encrypt each key-value pair
-		encryptedObject := make(map[string]interface{})
-		for key, value := range v {
-			encrypted, err := EncryptStruct(value, publicKey, N)
-
-			if err != nil {
-				return nil, err
-			}
+	message, err := decryptInt(random, cipherTextNumber, keys)
 
-			encryptedObject[key] = encrypted
-		}
-		return encryptedObject, nil
-	default:
-		// Return other types unchanged
-		return nil, errors.New(fmt.Sprintf("Unsupported json type: %T", json))
+	if err != nil {
+		return "", err
 	}
-}
-
-func DecryptStruct(json interface{}, privateKey, N *big.Int) (interface{}, error) {
-	// Recursively decrypt the values in a JSON object (including nested structures).
-	switch v := json.(type) {
-	case string:
-		return Decrypt(v, privateKey, N)
-	case int:
-		// If it's an int, we need to decrypt it as a string first, then convert it back to an int,
-		return Decrypt(strconv.Itoa(v), privateKey, N)
-	case float64:
-		// Similarly, handle floats by decrypting and converting them back,
-		return Decrypt(strconv.FormatFloat(v, 'f', -1, 64), privateKey, N)
-	case []interface{}:
-		// For lists, recursively decrypt each item
-		decryptedList := make([]interface{}, len(v))
-		for i, item := range v {
-			decrypted, err := DecryptStruct(item, privateKey, N)
-
-			if err != nil {
-				return nil, err
-			}
 
-			decryptedList[i] = decrypted
-		}
-		return decryptedList, nil
-	case map[string]interface{}:
-		// For objects, recursively decrypt each key-value pair,
-		decryptedObject := make(map[string]interface{})
-		for key, value := range v {
-			decrypted, err := DecryptStruct(value, privateKey, N)
-
-			if err != nil {
-				return nil, err
-			}
-
-			decryptedObject[key] = decrypted
-		}
-		return decryptedObject, nil
-	default:
-		// Return other types unchanged.
-		return nil, errors.New(fmt.Sprintf("Unsupported json type: %T", json))
-	}
+	return bigIntToString(message), nil
 }
@@ -0,0 +1,330 @@
+package rsa
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// PEM block types produced and accepted by this package.
+const (
+	PKCS1PrivateKeyPEMType = "RSA PRIVATE KEY"
+	PKCS1PublicKeyPEMType  = "RSA PUBLIC KEY"
+	PKCS8PrivateKeyPEMType = "PRIVATE KEY"
+	PKIXPublicKeyPEMType   = "PUBLIC KEY"
+)
+
+// rsaEncryption object identifier from RFC 8017.
+var oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+
+// RSAPrivateKey from RFC 8017 appendix A.1.2, only two-prime keys are supported.
+type pkcs1PrivateKey struct {
+	Version int
+	N       *big.Int
+	E       *big.Int
+	D       *big.Int
+	P       *big.Int
+	Q       *big.Int
+	DP      *big.Int
+	DQ      *big.Int
+	QInv    *big.Int
+
+	OtherPrimeInfos []asn1.RawValue `asn1:"optional,omitempty"`
+}
+
+// RSAPublicKey from RFC 8017 appendix A.1.1.
+type pkcs1PublicKey struct {
+	N *big.Int
+	E *big.Int
+}
+
+// PrivateKeyInfo from RFC 5208.
+type pkcs8PrivateKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	Attributes asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// SubjectPublicKeyInfo from RFC 5280.
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// MarshalPKCS1PrivateKey encodes keys as PKCS#1 RSAPrivateKey DER, keys must have primes.
+func MarshalPKCS1PrivateKey(keys *Keys) ([]byte, error) {
+	if keys.P == nil || keys.Q == nil {
+		return nil, errors.New("PKCS#1 private key requires primes p and q")
+	}
+
+	// Missing CRT parameters are calculated on a copy, caller's keys are not modified.
+	withCRT := *keys
+	if !withCRT.hasCRT() {
+		if err := withCRT.Precompute(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := withCRT.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	return asn1.Marshal(pkcs1PrivateKey{
+		N:    withCRT.N,
+		E:    withCRT.PublicKey,
+		D:    withCRT.PrivateKey,
+		P:    withCRT.P,
+		Q:    withCRT.Q,
+		DP:   withCRT.DP,
+		DQ:   withCRT.DQ,
+		QInv: withCRT.QInv,
+	})
+}
+
+// ParsePKCS1PrivateKey decodes PKCS#1 RSAPrivateKey DER and validates the result.
+func ParsePKCS1PrivateKey(der []byte) (*Keys, error) {
+	var key pkcs1PrivateKey
+
+	if err := unmarshalDER(der, &key, "PKCS#1 private key"); err != nil {
+		return nil, err
+	}
+
+	if key.Version > 1 {
+		return nil, errors.New(fmt.Sprintf("PKCS#1 private key: unknown version %d", key.Version))
+	}
+
+	if key.Version == 1 || len(key.OtherPrimeInfos) > 0 {
+		return nil, errors.New("PKCS#1 private key: multi-prime keys are not supported")
+	}
+
+	for _, value := range []*big.Int{key.N, key.E, key.D, key.P, key.Q, key.DP, key.DQ, key.QInv} {
+		if value.Sign() <= 0 {
+			return nil, errors.New("PKCS#1 private key: integers must be positive")
+		}
+	}
+
+	keys := &Keys{
+		PublicKey:  key.E,
+		PrivateKey: key.D,
+		N:          key.N,
+		P:          key.P,
+		Q:          key.Q,
+		DP:         key.DP,
+		DQ:         key.DQ,
+		QInv:       key.QInv,
+	}
+
+	if err := keys.Validate(); err != nil {
+		return nil, fmt.Errorf("PKCS#1 private key: %w", err)
+	}
+
+	return keys, nil
+}
+
+// MarshalPKCS1PublicKey encodes public key as PKCS#1 RSAPublicKey DER.
+func MarshalPKCS1PublicKey(publicKey, N *big.Int) ([]byte, error) {
+	if err := validatePublicKey(publicKey, N); err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs1PublicKey{N: N, E: publicKey})
+}
+
+// ParsePKCS1PublicKey decodes PKCS#1 RSAPublicKey DER, returned keys have only PublicKey and N.
+func ParsePKCS1PublicKey(der []byte) (*Keys, error) {
+	var key pkcs1PublicKey
+
+	if err := unmarshalDER(der, &key, "PKCS#1 public key"); err != nil {
+		return nil, err
+	}
+
+	if err := validatePublicKey(key.E, key.N); err != nil {
+		return nil, fmt.Errorf("PKCS#1 public key: %w", err)
+	}
+
+	return &Keys{PublicKey: key.E, N: key.N}, nil
+}
+
+// MarshalPKCS8PrivateKey encodes keys as PKCS#8 PrivateKeyInfo DER with rsaEncryption algorithm.
+func MarshalPKCS8PrivateKey(keys *Keys) ([]byte, error) {
+	pkcs1, err := MarshalPKCS1PrivateKey(keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs8PrivateKey{
+		Algorithm:  pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+		PrivateKey: pkcs1,
+	})
+}
+
+// ParsePKCS8PrivateKey decodes PKCS#8 PrivateKeyInfo DER which holds an RSA key.
+func ParsePKCS8PrivateKey(der []byte) (*Keys, error) {
+	var key pkcs8PrivateKey
+
+	if err := unmarshalDER(der, &key, "PKCS#8 private key"); err != nil {
+		return nil, err
+	}
+
+	if key.Version != 0 {
+		return nil, errors.New(fmt.Sprintf("PKCS#8 private key: unknown version %d", key.Version))
+	}
+
+	if err := checkRSAAlgorithm(key.Algorithm); err != nil {
+		return nil, fmt.Errorf("PKCS#8 private key: %w", err)
+	}
+
+	return ParsePKCS1PrivateKey(key.PrivateKey)
+}
+
+// MarshalPKIXPublicKey encodes public key as SubjectPublicKeyInfo DER, the format of openssl "PUBLIC KEY".
+func MarshalPKIXPublicKey(publicKey, N *big.Int) ([]byte, error) {
+	pkcs1, err := MarshalPKCS1PublicKey(publicKey, N)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+		PublicKey: asn1.BitString{Bytes: pkcs1, BitLength: 8 * len(pkcs1)},
+	})
+}
+
+// ParsePKIXPublicKey decodes SubjectPublicKeyInfo DER which holds an RSA key.
+func ParsePKIXPublicKey(der []byte) (*Keys, error) {
+	var info subjectPublicKeyInfo
+
+	if err := unmarshalDER(der, &info, "public key info"); err != nil {
+		return nil, err
+	}
+
+	if err := checkRSAAlgorithm(info.Algorithm); err != nil {
+		return nil, fmt.Errorf("public key info: %w", err)
+	}
+
+	if info.PublicKey.BitLength%8 != 0 {
+		return nil, errors.New("public key info: public key is not a whole number of bytes")
+	}
+
+	return ParsePKCS1PublicKey(info.PublicKey.Bytes)
+}
+
+// MarshalPrivateKeyPEM encodes keys as PEM, pemType is PKCS1PrivateKeyPEMType or PKCS8PrivateKeyPEMType.
+func MarshalPrivateKeyPEM(keys *Keys, pemType string) ([]byte, error) {
+	var der []byte
+	var err error
+
+	switch pemType {
+	case PKCS1PrivateKeyPEMType:
+		der, err = MarshalPKCS1PrivateKey(keys)
+	case PKCS8PrivateKeyPEMType:
+		der, err = MarshalPKCS8PrivateKey(keys)
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported private key PEM type %q", pemType))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), nil
+}
+
+// MarshalPublicKeyPEM encodes public key as PEM, pemType is PKCS1PublicKeyPEMType or PKIXPublicKeyPEMType.
+func MarshalPublicKeyPEM(publicKey, N *big.Int, pemType string) ([]byte, error) {
+	var der []byte
+	var err error
+
+	switch pemType {
+	case PKCS1PublicKeyPEMType:
+		der, err = MarshalPKCS1PublicKey(publicKey, N)
+	case PKIXPublicKeyPEMType:
+		der, err = MarshalPKIXPublicKey(publicKey, N)
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported public key PEM type %q", pemType))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), nil
+}
+
+// ParsePEM decodes the first PEM block of any supported type, public keys have no PrivateKey.
+func ParsePEM(data []byte) (*Keys, error) {
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if len(block.Headers) > 0 {
+		return nil, errors.New("encrypted or annotated PEM blocks are not supported")
+	}
+
+	switch block.Type {
+	case PKCS1PrivateKeyPEMType:
+		return ParsePKCS1PrivateKey(block.Bytes)
+	case PKCS1PublicKeyPEMType:
+		return ParsePKCS1PublicKey(block.Bytes)
+	case PKCS8PrivateKeyPEMType:
+		return ParsePKCS8PrivateKey(block.Bytes)
+	case PKIXPublicKeyPEMType:
+		return ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported PEM block type %q", block.Type))
+	}
+}
+
+// Unmarshals DER and rejects trailing data, errors are prefixed with the structure name.
+func unmarshalDER(der []byte, value interface{}, name string) error {
+	rest, err := asn1.Unmarshal(der, value)
+
+	if err != nil {
+		return fmt.Errorf("%s: malformed ASN.1: %w", name, err)
+	}
+
+	if len(rest) > 0 {
+		return errors.New(fmt.Sprintf("%s: trailing data after ASN.1 structure", name))
+	}
+
+	return nil
+}
+
+// Checks that algorithm is rsaEncryption with absent or NULL parameters.
+func checkRSAAlgorithm(algorithm pkix.AlgorithmIdentifier) error {
+	if !algorithm.Algorithm.Equal(oidRSAEncryption) {
+		return errors.New(fmt.Sprintf("unsupported algorithm %s, expected rsaEncryption", algorithm.Algorithm))
+	}
+
+	parameters := algorithm.Parameters.FullBytes
+	if len(parameters) > 0 && string(parameters) != string(asn1.NullBytes) {
+		return errors.New("rsaEncryption parameters must be NULL")
+	}
+
+	return nil
+}
+
+// Checks that public exponent and modulus are usable.
+func validatePublicKey(publicKey, N *big.Int) error {
+	if N == nil || publicKey == nil {
+		return errors.New("public key and N are required")
+	}
+
+	if N.Sign() <= 0 || N.Bit(0) == 0 {
+		return errors.New("N must be positive and odd")
+	}
+
+	if publicKey.Cmp(big.NewInt(1)) <= 0 || publicKey.Bit(0) == 0 || publicKey.Cmp(N) >= 0 {
+		return errors.New("public key must be odd and in range (1, N)")
+	}
+
+	return nil
+}
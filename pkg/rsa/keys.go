@@ -6,10 +6,23 @@ import (
 	"math/big"
 )
 
+// Smallest supported modulus size in bits.
+const minBitSize = 32
+
+// Public exponent used for generated keys.
+var publicExponent = big.NewInt(65537)
+
 type Keys struct {
 	PublicKey  *big.Int
 	PrivateKey *big.Int
 	N          *big.Int
+
+	// Optional CRT parameters, private key operations use them when all of them are present.
+	P    *big.Int
+	Q    *big.Int
+	DP   *big.Int
+	DQ   *big.Int
+	QInv *big.Int
 }
 
 type PrimeNumbers struct {
@@ -19,31 +32,74 @@ type PrimeNumbers struct {
 	phi *big.Int
 }
 
+// GeneratePrimes generates p and q, so that N = p*q has exactly bitSize bits.
 func GeneratePrimes(bitSize int) (PrimeNumbers, error) {
-	// Generating big prime numbers.
-	p, err := GenerateLargePrime(bitSize)
+	if bitSize < minBitSize {
+		return PrimeNumbers{}, errors.New(fmt.Sprintf("RSA modulus must be at least %d bit.", minBitSize))
+	}
 
-	if err != nil {
-		return PrimeNumbers{}, errors.New(fmt.Sprintf("Failed to generate prime number of %d bit.", bitSize))
+	pBitSize := (bitSize + 1) / 2
+	qBitSize := bitSize - pBitSize
+
+	// p and q must not be close, otherwise N is factored by Fermat's method.
+	// FIPS 186-4 requires |p-q| > 2^(nlen/2 - 100), small keys use half of the prime size instead.
+	minDistanceBits := pBitSize - 100
+	if minDistanceBits < pBitSize/2 {
+		minDistanceBits = pBitSize / 2
 	}
 
-	q, err := GenerateLargePrime(bitSize)
+	for {
+		// Generating big prime numbers.
+		p, err := generateKeyPrime(pBitSize)
 
-	if err != nil {
-		return PrimeNumbers{}, errors.New(fmt.Sprintf("Failed to generate prime number of %d bit.", bitSize))
+		if err != nil {
+			return PrimeNumbers{}, err
+		}
+
+		q, err := generateKeyPrime(qBitSize)
+
+		if err != nil {
+			return PrimeNumbers{}, err
+		}
+
+		if new(big.Int).Sub(p, q).CmpAbs(new(big.Int).Lsh(big.NewInt(1), uint(minDistanceBits))) <= 0 {
+			continue
+		}
+
+		var n, phi = new(big.Int), new(big.Int)
+
+		// Calculates N (p*q).
+		n.Mul(p, q)
+
+		if n.BitLen() != bitSize {
+			continue
+		}
+
+		// Calculates phi (p-1)*(q-1).
+		phi.Mul(new(big.Int).Sub(p, big.NewInt(1)), new(big.Int).Sub(q, big.NewInt(1)))
+
+		return PrimeNumbers{p, q, n, phi}, nil
 	}
+}
 
-	var n, phi = new(big.Int), new(big.Int)
+// Generates prime for which gcd(e, prime-1) = 1, so the private exponent exists.
+func generateKeyPrime(bitSize int) (*big.Int, error) {
+	for {
+		prime, err := GenerateLargePrime(bitSize)
 
-	// Calculates N (p*q).
-	n.Mul(p, q)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to generate prime number of %d bit.", bitSize))
+		}
 
-	// Calculates phi (p-1)*(q-1).
-	phi.Mul(new(big.Int).Sub(p, big.NewInt(1)), new(big.Int).Sub(q, big.NewInt(1)))
+		gcd, _, _ := XGCD(new(big.Int).Set(publicExponent), new(big.Int).Sub(prime, big.NewInt(1)))
 
-	return PrimeNumbers{p, phi, n, phi}, nil
+		if gcd.Cmp(big.NewInt(1)) == 0 {
+			return prime, nil
+		}
+	}
 }
 
+// GenerateKeys generates keys with modulus of bitSize bits.
 func GenerateKeys(bitSize int) (*Keys, error) {
 	primes, err := GeneratePrimes(bitSize)
 
@@ -51,7 +107,7 @@ func GenerateKeys(bitSize int) (*Keys, error) {
 		return &Keys{}, err
 	}
 
-	encrypt := big.NewInt(65537)
+	encrypt := new(big.Int).Set(publicExponent)
 
 	decrypt, err := inverse(encrypt, primes.phi)
 
@@ -59,5 +115,127 @@ func GenerateKeys(bitSize int) (*Keys, error) {
 		return &Keys{}, err
 	}
 
-	return &Keys{PublicKey: encrypt, PrivateKey: decrypt, N: primes.n}, nil
+	keys := &Keys{PublicKey: encrypt, PrivateKey: decrypt, N: primes.n, P: primes.p, Q: primes.q}
+
+	if err := keys.Precompute(); err != nil {
+		return &Keys{}, err
+	}
+
+	if err := keys.Validate(); err != nil {
+		return &Keys{}, err
+	}
+
+	return keys, nil
+}
+
+// Precompute calculates DP, DQ and QInv from the primes, keys without primes are left untouched.
+func (k *Keys) Precompute() error {
+	if k.P == nil || k.Q == nil {
+		return nil
+	}
+
+	one := big.NewInt(1)
+
+	// DP = d mod (p-1), DQ = d mod (q-1).
+	k.DP = new(big.Int).Mod(k.PrivateKey, new(big.Int).Sub(k.P, one))
+	k.DQ = new(big.Int).Mod(k.PrivateKey, new(big.Int).Sub(k.Q, one))
+
+	qInv, err := inverse(k.Q, k.P)
+
+	if err != nil {
+		return err
+	}
+
+	k.QInv = qInv
+
+	return nil
+}
+
+// Validate checks every key invariant, CRT parameters are checked only when present.
+func (k *Keys) Validate() error {
+	one := big.NewInt(1)
+
+	if k.N == nil || k.PublicKey == nil || k.PrivateKey == nil {
+		return errors.New("public key, private key and N are required")
+	}
+
+	if k.N.Cmp(one) <= 0 {
+		return errors.New("N must be greater than 1")
+	}
+
+	if k.PublicKey.Cmp(one) <= 0 || k.PublicKey.Bit(0) == 0 || k.PublicKey.Cmp(k.N) >= 0 {
+		return errors.New("public key must be odd and in range (1, N)")
+	}
+
+	if k.PrivateKey.Sign() <= 0 || k.PrivateKey.Cmp(k.N) >= 0 {
+		return errors.New("private key must be in range (0, N)")
+	}
+
+	if k.P == nil && k.Q == nil {
+		if k.DP != nil || k.DQ != nil || k.QInv != nil {
+			return errors.New("CRT parameters are present without primes")
+		}
+
+		// Without primes the only check left is that exponents are inverse to each other.
+		m := big.NewInt(2)
+		c := new(big.Int).Exp(m, k.PublicKey, k.N)
+
+		if new(big.Int).Exp(c, k.PrivateKey, k.N).Cmp(m) != 0 {
+			return errors.New("public and private keys do not match")
+		}
+
+		return nil
+	}
+
+	if k.P == nil || k.Q == nil {
+		return errors.New("both primes are required")
+	}
+
+	if !k.P.ProbablyPrime(20) || !k.Q.ProbablyPrime(20) {
+		return errors.New("p and q must be prime")
+	}
+
+	if k.P.Cmp(k.Q) == 0 {
+		return errors.New("p and q must be different")
+	}
+
+	if new(big.Int).Mul(k.P, k.Q).Cmp(k.N) != 0 {
+		return errors.New("N must be equal to p*q")
+	}
+
+	// e*d = 1 mod (p-1) and mod (q-1) also implies gcd(e, p-1) = gcd(e, q-1) = 1.
+	ed := new(big.Int).Mul(k.PublicKey, k.PrivateKey)
+
+	for _, prime := range []*big.Int{k.P, k.Q} {
+		if new(big.Int).Mod(ed, new(big.Int).Sub(prime, one)).Cmp(one) != 0 {
+			return errors.New("private key is not inverse of public key")
+		}
+	}
+
+	if k.DP == nil && k.DQ == nil && k.QInv == nil {
+		return nil
+	}
+
+	if !k.hasCRT() {
+		return errors.New("CRT parameters are incomplete")
+	}
+
+	if k.DP.Cmp(new(big.Int).Mod(k.PrivateKey, new(big.Int).Sub(k.P, one))) != 0 {
+		return errors.New("DP must be equal to d mod (p-1)")
+	}
+
+	if k.DQ.Cmp(new(big.Int).Mod(k.PrivateKey, new(big.Int).Sub(k.Q, one))) != 0 {
+		return errors.New("DQ must be equal to d mod (q-1)")
+	}
+
+	if k.QInv.Sign() <= 0 || k.QInv.Cmp(k.P) >= 0 || new(big.Int).Mod(new(big.Int).Mul(k.QInv, k.Q), k.P).Cmp(one) != 0 {
+		return errors.New("QInv must be inverse of q mod p")
+	}
+
+	return nil
+}
+
+// Checks whether all CRT parameters are present.
+func (k *Keys) hasCRT() bool {
+	return k.P != nil && k.Q != nil && k.DP != nil && k.DQ != nil && k.QInv != nil
 }
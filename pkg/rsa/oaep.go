@@ -0,0 +1,142 @@
+package rsa
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"hash"
+	"io"
+	"math/big"
+)
+
+// EncryptOAEP encrypts message with RSAES-OAEP from RFC 8017. Hash is used for the label and MGF1,
+// SHA-256 is used when hash is nil. Label may be empty, the same label must be given to DecryptOAEP.
+func EncryptOAEP(hash hash.Hash, random io.Reader, message, label []byte, publicKey, N *big.Int) ([]byte, error) {
+	if hash == nil {
+		hash = sha256.New()
+	}
+	hash.Reset()
+
+	k := modulusSize(N)
+	hashSize := hash.Size()
+
+	if len(message) > k-2*hashSize-2 {
+		return nil, errors.New("message too long for RSA key size")
+	}
+
+	hash.Write(label)
+	labelHash := hash.Sum(nil)
+	hash.Reset()
+
+	// EM = 0x00 || maskedSeed || maskedDB, where DB = lHash || PS || 0x01 || M.
+	em := make([]byte, k)
+	seed := em[1 : 1+hashSize]
+	db := em[1+hashSize:]
+
+	copy(db, labelHash)
+	db[len(db)-len(message)-1] = 1
+	copy(db[len(db)-len(message):], message)
+
+	if _, err := io.ReadFull(random, seed); err != nil {
+		return nil, err
+	}
+
+	mgf1XOR(db, hash, seed)
+	mgf1XOR(seed, hash, db)
+
+	c, err := encryptInt(new(big.Int).SetBytes(em), publicKey, N)
+	if err != nil {
+		return nil, err
+	}
+
+	return intToBytes(c, k), nil
+}
+
+// DecryptOAEP decrypts output of EncryptOAEP, all malformed encodings produce the same ErrDecryption.
+// Random is the source for blinding, nil means crypto/rand.Reader.
+func DecryptOAEP(hash hash.Hash, random io.Reader, cipherText, label []byte, keys *Keys) ([]byte, error) {
+	if hash == nil {
+		hash = sha256.New()
+	}
+	hash.Reset()
+
+	k := modulusSize(keys.N)
+	hashSize := hash.Size()
+
+	if len(cipherText) != k || k < 2*hashSize+2 {
+		return nil, ErrDecryption
+	}
+
+	m, err := decryptInt(random, new(big.Int).SetBytes(cipherText), keys)
+	if errors.Is(err, ErrBlindingImpossible) {
+		// Depends only on the keys, so it tells an attacker nothing about the ciphertext.
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrDecryption
+	}
+
+	hash.Write(label)
+	labelHash := hash.Sum(nil)
+	hash.Reset()
+
+	em := intToBytes(m, k)
+	firstByteIsZero := subtle.ConstantTimeByteEq(em[0], 0)
+
+	seed := em[1 : 1+hashSize]
+	db := em[1+hashSize:]
+
+	mgf1XOR(seed, hash, db)
+	mgf1XOR(db, hash, seed)
+
+	labelHashValid := subtle.ConstantTimeCompare(db[:hashSize], labelHash)
+
+	// Searches for the 0x01 separator without branches on the decrypted data.
+	var lookingForIndex, index, invalid int
+	lookingForIndex = 1
+	rest := db[hashSize:]
+
+	for i := 0; i < len(rest); i++ {
+		equals0 := subtle.ConstantTimeByteEq(rest[i], 0)
+		equals1 := subtle.ConstantTimeByteEq(rest[i], 1)
+		index = subtle.ConstantTimeSelect(lookingForIndex&equals1, i, index)
+		lookingForIndex = subtle.ConstantTimeSelect(equals1, 0, lookingForIndex)
+		invalid = subtle.ConstantTimeSelect(lookingForIndex&^equals0, 1, invalid)
+	}
+
+	if firstByteIsZero&labelHashValid&^invalid&^lookingForIndex != 1 {
+		return nil, ErrDecryption
+	}
+
+	return rest[index+1:], nil
+}
+
+// Mask generation function MGF1, xors out with the mask derived from seed.
+func mgf1XOR(out []byte, hash hash.Hash, seed []byte) {
+	var counter [4]byte
+	var digest []byte
+
+	done := 0
+	for done < len(out) {
+		hash.Write(seed)
+		hash.Write(counter[:])
+		digest = hash.Sum(digest[:0])
+		hash.Reset()
+
+		for i := 0; i < len(digest) && done < len(out); i++ {
+			out[done] ^= digest[i]
+			done++
+		}
+		incrementCounter(&counter)
+	}
+}
+
+// Increments big-endian 32-bit counter used by MGF1.
+func incrementCounter(counter *[4]byte) {
+	for i := 3; i >= 0; i-- {
+		counter[i]++
+		if counter[i] != 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package rsa
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"math/bits"
+)
+
+// EncryptPKCS1v15 encrypts message with RSAES-PKCS1-v1_5 (block type 2) padding.
+// Use it only for legacy systems, EncryptOAEP should be preferred.
+func EncryptPKCS1v15(random io.Reader, message []byte, publicKey, N *big.Int) ([]byte, error) {
+	k := modulusSize(N)
+
+	if len(message) > k-11 {
+		return nil, errors.New("message too long for RSA key size")
+	}
+
+	// EM = 0x00 || 0x02 || PS || 0x00 || M, where PS are at least 8 random non-zero bytes.
+	em := make([]byte, k)
+	em[1] = 2
+	padding := em[2 : len(em)-len(message)-1]
+	copy(em[len(em)-len(message):], message)
+
+	if err := nonZeroRandomBytes(padding, random); err != nil {
+		return nil, err
+	}
+
+	c, err := encryptInt(new(big.Int).SetBytes(em), publicKey, N)
+	if err != nil {
+		return nil, err
+	}
+
+	return intToBytes(c, k), nil
+}
+
+// DecryptPKCS1v15 decrypts output of EncryptPKCS1v15 with strict structure checks.
+// Error tells whether padding was valid, so it must not be exposed to an attacker (Bleichenbacher's attack),
+// use DecryptPKCS1v15ImplicitRejection in that case. Random is the source for blinding, nil means crypto/rand.Reader.
+func DecryptPKCS1v15(random io.Reader, cipherText []byte, keys *Keys) ([]byte, error) {
+	valid, em, index, err := decryptPKCS1v15(random, cipherText, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if valid == 0 {
+		return nil, ErrDecryption
+	}
+
+	return em[index:], nil
+}
+
+// DecryptPKCS1v15ImplicitRejection decrypts output of EncryptPKCS1v15, but instead of a padding error it returns
+// a synthetic message derived from the private key and the ciphertext. So the same ciphertext always gives
+// the same result and the caller cannot distinguish invalid padding from a wrong message.
+func DecryptPKCS1v15ImplicitRejection(random io.Reader, cipherText []byte, keys *Keys) ([]byte, error) {
+	valid, em, index, err := decryptPKCS1v15(random, cipherText, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	k := len(em)
+	synthetic, syntheticLength := syntheticMessage(cipherText, keys, k)
+
+	// Both candidates are right aligned in k bytes, the result is selected without branches.
+	messageLength := subtle.ConstantTimeSelect(valid, k-index, syntheticLength)
+	result := make([]byte, k)
+	copy(result, synthetic)
+	subtle.ConstantTimeCopy(valid, result, em)
+
+	return result[k-messageLength:], nil
+}
+
+// Decrypts and checks padding in constant time, returns valid flag, encoded message and index of message start.
+func decryptPKCS1v15(random io.Reader, cipherText []byte, keys *Keys) (int, []byte, int, error) {
+	k := modulusSize(keys.N)
+
+	if k < 11 || len(cipherText) != k {
+		return 0, nil, 0, ErrDecryption
+	}
+
+	m, err := decryptInt(random, new(big.Int).SetBytes(cipherText), keys)
+	if errors.Is(err, ErrBlindingImpossible) {
+		// Depends only on the keys, so it tells an attacker nothing about the ciphertext.
+		return 0, nil, 0, err
+	}
+	if err != nil {
+		return 0, nil, 0, ErrDecryption
+	}
+
+	em := intToBytes(m, k)
+	firstByteIsZero := subtle.ConstantTimeByteEq(em[0], 0)
+	secondByteIsTwo := subtle.ConstantTimeByteEq(em[1], 2)
+
+	// Searches for the first zero byte after the padding.
+	lookingForIndex := 1
+	index := 0
+	for i := 2; i < len(em); i++ {
+		equals0 := subtle.ConstantTimeByteEq(em[i], 0)
+		index = subtle.ConstantTimeSelect(lookingForIndex&equals0, i, index)
+		lookingForIndex = subtle.ConstantTimeSelect(equals0, 0, lookingForIndex)
+	}
+
+	// Padding must be at least 8 bytes long.
+	validPaddingLength := subtle.ConstantTimeLessOrEq(2+8, index)
+
+	valid := firstByteIsZero & secondByteIsTwo & (^lookingForIndex & 1) & validPaddingLength
+	index = subtle.ConstantTimeSelect(valid, index+1, 0)
+
+	return valid, em, index, nil
+}
+
+// Derives the message returned on implicit rejection, as described in draft-irtf-cfrg-rsa-guidance.
+// Returns k bytes where the message is right aligned and its length.
+func syntheticMessage(cipherText []byte, keys *Keys, k int) ([]byte, int) {
+	// Key derivation key depends on the private exponent and the ciphertext.
+	privateKeyHash := sha256.Sum256(intToBytes(keys.PrivateKey, k))
+	kdk := hmac.New(sha256.New, privateKeyHash[:])
+	kdk.Write(cipherText)
+	derivationKey := kdk.Sum(nil)
+
+	message := implicitRejectionPRF(derivationKey, "message", k)
+	candidates := implicitRejectionPRF(derivationKey, "length", 256)
+
+	maxLength := k - 11
+	mask := 1<<bits.Len(uint(maxLength)) - 1
+
+	// Takes the last candidate which fits, without branches on the secret candidates.
+	length := 0
+	for i := 0; i < len(candidates); i += 2 {
+		candidate := int(binary.BigEndian.Uint16(candidates[i:])) & mask
+		length = subtle.ConstantTimeSelect(subtle.ConstantTimeLessOrEq(candidate, maxLength), candidate, length)
+	}
+
+	return message, length
+}
+
+// Pseudo random function from draft-irtf-cfrg-rsa-guidance, output is size bytes long.
+func implicitRejectionPRF(key []byte, label string, size int) []byte {
+	output := make([]byte, 0, size+sha256.Size)
+	mac := hmac.New(sha256.New, key)
+
+	var counter, bitLength [2]byte
+	binary.BigEndian.PutUint16(bitLength[:], uint16(size*8))
+
+	for i := 0; len(output) < size; i++ {
+		binary.BigEndian.PutUint16(counter[:], uint16(i))
+		mac.Reset()
+		mac.Write(counter[:])
+		mac.Write([]byte(label))
+		mac.Write(bitLength[:])
+		output = mac.Sum(output)
+	}
+
+	return output[:size]
+}
+
+// Fills bytes with random non-zero values.
+func nonZeroRandomBytes(bytes []byte, random io.Reader) error {
+	if _, err := io.ReadFull(random, bytes); err != nil {
+		return err
+	}
+
+	for i := range bytes {
+		for bytes[i] == 0 {
+			if _, err := io.ReadFull(random, bytes[i:i+1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
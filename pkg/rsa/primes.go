@@ -2,10 +2,15 @@ package rsa
 
 import (
 	"crypto/rand"
+	"errors"
 	"math/big"
 )
 
 func GenerateLargePrime(bits int) (*big.Int, error) {
+	if bits < 2 {
+		return nil, errors.New("prime number must be at least 2 bits long")
+	}
+
 	// Generate a random number of the specified bit length.
 	for {
 		num, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
@@ -14,9 +19,13 @@ func GenerateLargePrime(bits int) (*big.Int, error) {
 			return nil, err
 		}
 
-		num.Add(num, new(big.Int).Lsh(big.NewInt(1), uint(bits-1)))
+		// Two top bits are set, so product of two such primes has exactly the sum of their bit lengths.
+		num.SetBit(num, bits-1, 1)
+		num.SetBit(num, bits-2, 1)
+		// Even numbers are never prime.
+		num.SetBit(num, 0, 1)
 
-		if num.ProbablyPrime(10) {
+		if num.ProbablyPrime(20) {
 			return num, nil
 		}
 	}
@@ -0,0 +1,101 @@
+package rsa
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// ErrDecryption is returned for any malformed encoding, details are hidden on purpose.
+var ErrDecryption = errors.New("decryption error")
+
+// ErrBlindingImpossible is returned by private key operations on keys without public key,
+// they are never performed unblinded.
+var ErrBlindingImpossible = errors.New("public key is required to blind private key operation")
+
+// Raw RSA public operation - m ^ publicKey % N.
+func encryptInt(m, publicKey, N *big.Int) (*big.Int, error) {
+	if m.Sign() < 0 || m.Cmp(N) >= 0 {
+		return nil, errors.New("message representative out of range")
+	}
+	return new(big.Int).Exp(m, publicKey, N), nil
+}
+
+// Raw RSA private operation - c ^ privateKey % N, uses CRT when keys have its parameters.
+// c is always blinded with random r before exponentiation, so timing does not depend on
+// the attacker supplied value. Nil random means crypto/rand.Reader.
+func decryptInt(random io.Reader, c *big.Int, keys *Keys) (*big.Int, error) {
+	if keys.PublicKey == nil {
+		return nil, ErrBlindingImpossible
+	}
+
+	if c.Sign() < 0 || c.Cmp(keys.N) >= 0 {
+		return nil, errors.New("ciphertext representative out of range")
+	}
+
+	if random == nil {
+		random = rand.Reader
+	}
+
+	r, rInverse, err := blindingFactor(random, keys.N)
+	if err != nil {
+		return nil, err
+	}
+
+	// c * r ^ publicKey % N decrypts to m * r, which is unblinded with r ^ -1.
+	blinded := new(big.Int).Exp(r, keys.PublicKey, keys.N)
+	blinded.Mul(blinded, c).Mod(blinded, keys.N)
+
+	m := privateExp(blinded, keys)
+	return m.Mul(m, rInverse).Mod(m, keys.N), nil
+}
+
+// Random r in range [1, N) which has an inverse mod N.
+func blindingFactor(random io.Reader, N *big.Int) (*big.Int, *big.Int, error) {
+	for {
+		r, err := rand.Int(random, N)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if r.Sign() == 0 {
+			continue
+		}
+
+		rInverse, err := inverse(r, N)
+
+		if err == nil {
+			return r, rInverse, nil
+		}
+	}
+}
+
+// Exponentiation with the private key, CRT is used when keys have its parameters.
+func privateExp(c *big.Int, keys *Keys) *big.Int {
+	if !keys.hasCRT() {
+		return new(big.Int).Exp(c, keys.PrivateKey, keys.N)
+	}
+
+	// m1 = c ^ DP % p, m2 = c ^ DQ % q.
+	m1 := new(big.Int).Exp(c, keys.DP, keys.P)
+	m2 := new(big.Int).Exp(c, keys.DQ, keys.Q)
+
+	// h = QInv * (m1 - m2) % p, m = m2 + h * q.
+	h := m1.Sub(m1, m2)
+	h.Mul(h, keys.QInv)
+	h.Mod(h, keys.P)
+
+	return h.Mul(h, keys.Q).Add(h, m2)
+}
+
+// Size of the modulus in bytes.
+func modulusSize(N *big.Int) int {
+	return (N.BitLen() + 7) / 8
+}
+
+// Converts number into big-endian bytes of exactly size length (I2OSP).
+func intToBytes(number *big.Int, size int) []byte {
+	return number.FillBytes(make([]byte, size))
+}
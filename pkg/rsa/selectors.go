@@ -0,0 +1,216 @@
+package rsa
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Selector segment kinds.
+const (
+	segmentKey = iota
+	segmentIndex
+	segmentWildcard
+)
+
+// One step of a selector: object key, array index or wildcard over all children.
+type segment struct {
+	kind  int
+	key   string
+	index int
+}
+
+// EncryptFields encrypts only values matched by selectors and leaves the rest of the document readable.
+// Selectors are JSONPath-like: $.user.ssn, $.cards[*].number, $.items[0], $['key with spaces'], $.*.
+// Matched object or array is encrypted as one value, so its structure is hidden too. Subtrees of any size
+// are supported, ones too long for OAEP are encrypted with AES-GCM like long values in EncryptStruct.
+// Selectors which match nothing are ignored, because optional fields may be absent. When selectors overlap,
+// the outermost matched value is encrypted. Plain object keys starting with $ are escaped like in EncryptStruct.
+func EncryptFields(json interface{}, selectors []string, publicKey, N *big.Int) (interface{}, error) {
+	paths := make([][]segment, len(selectors))
+
+	for i, selector := range selectors {
+		segments, err := parseSelector(selector)
+
+		if err != nil {
+			return nil, err
+		}
+
+		paths[i] = segments
+	}
+
+	return encryptSelected(json, paths, publicKey, N)
+}
+
+// DecryptFields decrypts every encrypted value found by its marker, other values are returned unchanged.
+// Escaped object keys are restored, unescaped keys starting with $ are rejected like in DecryptStruct.
+func DecryptFields(json interface{}, keys *Keys) (interface{}, error) {
+	switch v := json.(type) {
+	case []interface{}:
+		decryptedList := make([]interface{}, len(v))
+		for i, item := range v {
+			decrypted, err := DecryptFields(item, keys)
+
+			if err != nil {
+				return nil, err
+			}
+
+			decryptedList[i] = decrypted
+		}
+		return decryptedList, nil
+	case map[string]interface{}:
+		if isEncryptedValue(v) {
+			return decryptValue(v, keys)
+		}
+
+		decryptedObject := make(map[string]interface{})
+		for key, value := range v {
+			decrypted, err := DecryptFields(value, keys)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if err := setDecryptedKey(decryptedObject, key, decrypted, keys); err != nil {
+				return nil, err
+			}
+		}
+		return decryptedObject, nil
+	default:
+		return v, nil
+	}
+}
+
+// Walks all selectors at once and encrypts matched values. Paths hold the remaining segments of selectors
+// which matched the node so far, an empty path selects the node itself. Containers are copied with escaped
+// keys, so the caller's document is never modified.
+func encryptSelected(node interface{}, paths [][]segment, publicKey, N *big.Int) (interface{}, error) {
+	for _, path := range paths {
+		if len(path) == 0 {
+			return encryptValue(node, publicKey, N)
+		}
+	}
+
+	switch v := node.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			var childPaths [][]segment
+			for _, path := range paths {
+				if path[0].kind == segmentWildcard || path[0].kind == segmentKey && path[0].key == key {
+					childPaths = append(childPaths, path[1:])
+				}
+			}
+
+			encrypted, err := encryptSelected(value, childPaths, publicKey, N)
+
+			if err != nil {
+				return nil, err
+			}
+
+			copied[escapeKey(key)] = encrypted
+		}
+		return copied, nil
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, value := range v {
+			var childPaths [][]segment
+			for _, path := range paths {
+				if path[0].kind == segmentWildcard || path[0].kind == segmentIndex && path[0].index == i {
+					childPaths = append(childPaths, path[1:])
+				}
+			}
+
+			encrypted, err := encryptSelected(value, childPaths, publicKey, N)
+
+			if err != nil {
+				return nil, err
+			}
+
+			copied[i] = encrypted
+		}
+		return copied, nil
+	default:
+		// Scalar has no children to select.
+		return node, nil
+	}
+}
+
+// Parses selector like $.cards[*].number into segments.
+func parseSelector(selector string) ([]segment, error) {
+	if !strings.HasPrefix(selector, "$") {
+		return nil, errors.New(fmt.Sprintf("Selector %q must start with $", selector))
+	}
+
+	var segments []segment
+	rest := selector[1:]
+
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+
+			name := rest[:end]
+			rest = rest[end:]
+
+			if name == "" {
+				return nil, errors.New(fmt.Sprintf("Selector %q has an empty key", selector))
+			}
+
+			if name == "*" {
+				segments = append(segments, segment{kind: segmentWildcard})
+			} else {
+				segments = append(segments, segment{kind: segmentKey, key: name})
+			}
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, errors.New(fmt.Sprintf("Selector %q has unclosed bracket", selector))
+			}
+
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			parsed, err := parseBracket(inner)
+
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Selector %q: %s", selector, err))
+			}
+
+			segments = append(segments, parsed)
+		default:
+			return nil, errors.New(fmt.Sprintf("Selector %q has unexpected character %q", selector, rest[0]))
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, errors.New("Selector $ selects the whole document, use EncryptStruct instead")
+	}
+
+	return segments, nil
+}
+
+// Parses content of brackets: *, array index or quoted key.
+func parseBracket(inner string) (segment, error) {
+	if inner == "*" {
+		return segment{kind: segmentWildcard}, nil
+	}
+
+	if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+		return segment{kind: segmentKey, key: inner[1 : len(inner)-1]}, nil
+	}
+
+	index, err := strconv.Atoi(inner)
+
+	if err != nil || index < 0 {
+		return segment{}, errors.New(fmt.Sprintf("invalid bracket content %q", inner))
+	}
+
+	return segment{kind: segmentIndex, index: index}, nil
+}
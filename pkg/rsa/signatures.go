@@ -0,0 +1,253 @@
+package rsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// ErrVerification is returned when a signature does not match the message or the key.
+var ErrVerification = errors.New("verification error")
+
+const (
+	// PSSSaltLengthAuto signs with the longest possible salt and detects salt length on verification.
+	PSSSaltLengthAuto = 0
+	// PSSSaltLengthEqualsHash uses salt of the same length as the hash.
+	PSSSaltLengthEqualsHash = -1
+)
+
+// DER encoded DigestInfo prefixes for RSASSA-PKCS1-v1_5, see RFC 8017 section 9.2.
+var hashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA224: {0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// SignPKCS1v15 signs hashed message with RSASSA-PKCS1-v1_5, hashed must be the digest produced by hash.
+// Random is only used for blinding, the signature itself is deterministic.
+func SignPKCS1v15(random io.Reader, hash crypto.Hash, hashed []byte, keys *Keys) ([]byte, error) {
+	em, err := pkcs1v15SignatureEncoding(hash, hashed, modulusSize(keys.N))
+
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := decryptInt(random, new(big.Int).SetBytes(em), keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return intToBytes(s, len(em)), nil
+}
+
+// VerifyPKCS1v15 checks RSASSA-PKCS1-v1_5 signature of hashed message, returns nil if it is valid.
+func VerifyPKCS1v15(hash crypto.Hash, hashed, signature []byte, publicKey, N *big.Int) error {
+	k := modulusSize(N)
+
+	if len(signature) != k {
+		return ErrVerification
+	}
+
+	expected, err := pkcs1v15SignatureEncoding(hash, hashed, k)
+	if err != nil {
+		return err
+	}
+
+	m, err := encryptInt(new(big.Int).SetBytes(signature), publicKey, N)
+	if err != nil {
+		return ErrVerification
+	}
+
+	if subtle.ConstantTimeCompare(intToBytes(m, k), expected) != 1 {
+		return ErrVerification
+	}
+
+	return nil
+}
+
+// SignPSS signs hashed message with RSASSA-PSS, MGF1 uses the same hash.
+// Salt length may be PSSSaltLengthAuto, PSSSaltLengthEqualsHash or exact number of bytes.
+// Random is used both for the salt and for blinding.
+func SignPSS(random io.Reader, hash crypto.Hash, hashed []byte, saltLength int, keys *Keys) ([]byte, error) {
+	if !hash.Available() {
+		return nil, errors.New("hash function is not available")
+	}
+
+	emBits := keys.N.BitLen() - 1
+	emLength := (emBits + 7) / 8
+
+	switch saltLength {
+	case PSSSaltLengthAuto:
+		saltLength = emLength - hash.Size() - 2
+	case PSSSaltLengthEqualsHash:
+		saltLength = hash.Size()
+	}
+
+	if saltLength < 0 {
+		return nil, errors.New("invalid PSS salt length")
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, err
+	}
+
+	em, err := pssEncode(hash, hashed, salt, emBits)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := decryptInt(random, new(big.Int).SetBytes(em), keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return intToBytes(s, modulusSize(keys.N)), nil
+}
+
+// VerifyPSS checks RSASSA-PSS signature of hashed message, returns nil if it is valid.
+func VerifyPSS(hash crypto.Hash, hashed, signature []byte, saltLength int, publicKey, N *big.Int) error {
+	if !hash.Available() {
+		return errors.New("hash function is not available")
+	}
+
+	if len(signature) != modulusSize(N) {
+		return ErrVerification
+	}
+
+	m, err := encryptInt(new(big.Int).SetBytes(signature), publicKey, N)
+	if err != nil {
+		return ErrVerification
+	}
+
+	emBits := N.BitLen() - 1
+	emLength := (emBits + 7) / 8
+
+	// Encoded message may be one byte shorter than the modulus.
+	if m.BitLen() > emLength*8 {
+		return ErrVerification
+	}
+
+	if saltLength == PSSSaltLengthEqualsHash {
+		saltLength = hash.Size()
+	}
+
+	return pssVerify(hash, hashed, intToBytes(m, emLength), emBits, saltLength)
+}
+
+// EMSA-PKCS1-v1_5 encoding: 0x00 || 0x01 || 0xff... || 0x00 || DigestInfo.
+func pkcs1v15SignatureEncoding(hash crypto.Hash, hashed []byte, k int) ([]byte, error) {
+	prefix, ok := hashPrefixes[hash]
+
+	if !ok {
+		return nil, errors.New("unsupported hash function")
+	}
+
+	if len(hashed) != hash.Size() {
+		return nil, errors.New("input must be hashed message")
+	}
+
+	tLength := len(prefix) + len(hashed)
+	if k < tLength+11 {
+		return nil, errors.New("RSA key size is too small for the hash function")
+	}
+
+	em := make([]byte, k)
+	em[1] = 1
+	for i := 2; i < k-tLength-1; i++ {
+		em[i] = 0xff
+	}
+	copy(em[k-tLength:], prefix)
+	copy(em[k-len(hashed):], hashed)
+
+	return em, nil
+}
+
+// EMSA-PSS encoding from RFC 8017 section 9.1.1.
+func pssEncode(hash crypto.Hash, hashed, salt []byte, emBits int) ([]byte, error) {
+	hashSize := hash.Size()
+	emLength := (emBits + 7) / 8
+
+	if len(hashed) != hashSize {
+		return nil, errors.New("input must be hashed message")
+	}
+
+	if emLength < hashSize+len(salt)+2 {
+		return nil, errors.New("RSA key size is too small for the hash function and salt length")
+	}
+
+	em := make([]byte, emLength)
+	db := em[:emLength-hashSize-1]
+	h := em[emLength-hashSize-1 : emLength-1]
+
+	// H = Hash(0x00 * 8 || mHash || salt).
+	digest := hash.New()
+	digest.Write(make([]byte, 8))
+	digest.Write(hashed)
+	digest.Write(salt)
+	h = digest.Sum(h[:0])
+
+	// DB = PS || 0x01 || salt.
+	db[len(db)-len(salt)-1] = 1
+	copy(db[len(db)-len(salt):], salt)
+
+	mgf1XOR(db, hash.New(), h)
+
+	// Leftmost bits outside of emBits are cleared.
+	db[0] &= 0xff >> (8*emLength - emBits)
+	em[emLength-1] = 0xbc
+
+	return em, nil
+}
+
+// EMSA-PSS verification from RFC 8017 section 9.1.2, saltLength PSSSaltLengthAuto detects the salt.
+func pssVerify(hash crypto.Hash, hashed, em []byte, emBits, saltLength int) error {
+	hashSize := hash.Size()
+	emLength := (emBits + 7) / 8
+
+	if len(hashed) != hashSize || emLength < hashSize+saltLength+2 || saltLength < 0 {
+		return ErrVerification
+	}
+
+	if em[emLength-1] != 0xbc {
+		return ErrVerification
+	}
+
+	db := em[:emLength-hashSize-1]
+	h := em[emLength-hashSize-1 : emLength-1]
+
+	bitMask := byte(0xff >> (8*emLength - emBits))
+	if db[0]&^bitMask != 0 {
+		return ErrVerification
+	}
+
+	mgf1XOR(db, hash.New(), h)
+	db[0] &= bitMask
+
+	// DB must be PS of zeros, separator 0x01 and salt.
+	separator := bytes.IndexByte(db, 1)
+	if separator < 0 || !bytes.Equal(db[:separator], make([]byte, separator)) {
+		return ErrVerification
+	}
+
+	salt := db[separator+1:]
+	if saltLength != PSSSaltLengthAuto && len(salt) != saltLength {
+		return ErrVerification
+	}
+
+	digest := hash.New()
+	digest.Write(make([]byte, 8))
+	digest.Write(hashed)
+	digest.Write(salt)
+
+	if subtle.ConstantTimeCompare(digest.Sum(nil), h) != 1 {
+		return ErrVerification
+	}
+
+	return nil
+}
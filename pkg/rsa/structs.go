@@ -0,0 +1,371 @@
+package rsa
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mesiriak/cyphering/pkg/aes"
+	"math/big"
+	"strings"
+)
+
+// Every encrypted JSON value is replaced with an object holding RSA-OAEP (SHA-256) encryption
+// of its JSON encoding: {"$encrypted": "<hex ciphertext>"}. Encoding keeps the value type and OAEP
+// is randomized, so equal values, booleans and null cannot be recognized by their ciphertexts.
+// Encodings longer than OAEP allows are encrypted with AES-GCM under a fresh key, the ciphertext is then
+//
+//	RSA-OAEP wrapped AES key (modulus size) | GCM nonce (12) | AES-GCM ciphertext with tag
+//
+// and the wrapped key with the nonce is authenticated as GCM additional data. Both forms are told apart by length.
+const encryptedValueKey = "$encrypted"
+
+// Label binds encrypted values to JSON documents, so they cannot be reused in other OAEP protocols.
+var valueLabel = []byte("cyphering json value")
+
+// Object keys encrypted by EncryptStructWithKeys are replaced with this prefix followed by hex RSA-OAEP
+// ciphertext of the key: "$key:<hex ciphertext>".
+const encryptedKeyPrefix = "$key:"
+
+// Label for key tokens, so a token cannot be decrypted as a value and the other way round.
+var keyLabel = []byte("cyphering json key")
+
+// Keys starting with $ are reserved for the markers above. Plain object keys starting with $ are escaped
+// with one more $, so user data like {"$encrypted": "x"} or "$key:x" is never taken for a marker.
+const escapePrefix = "$"
+
+// EncryptStruct recursively encrypts every value of decoded JSON (including nested structures).
+// Objects and arrays keep their shape, each string, number, boolean and null is replaced with an encrypted value.
+// Values of any length are supported, the modulus must have at least 656 bits to wrap an AES key.
+// Object keys starting with $ are escaped, so they never collide with markers.
+// Decode JSON with json.Decoder.UseNumber to keep numbers exactly as they were written.
+func EncryptStruct(json interface{}, publicKey, N *big.Int) (interface{}, error) {
+	return encryptStruct(json, publicKey, N, false)
+}
+
+// EncryptStructWithKeys encrypts like EncryptStruct, but also replaces every object key with a token.
+// Every token is a fresh randomized OAEP encryption of the key name, so holders of the public key cannot
+// confirm guessed names by encrypting them, and equal names get different tokens. Only the number of keys
+// in each object and lengths of names too long for OAEP, which are encrypted like long values, stay visible.
+// Lookups by key are impossible without decryption. DecryptStruct and DecryptFields restore original key names.
+func EncryptStructWithKeys(json interface{}, publicKey, N *big.Int) (interface{}, error) {
+	return encryptStruct(json, publicKey, N, true)
+}
+
+func encryptStruct(json interface{}, publicKey, N *big.Int, encryptKeys bool) (interface{}, error) {
+	switch v := json.(type) {
+	case []interface{}:
+		// For lists, recursively encrypt each item
+		encryptedList := make([]interface{}, len(v))
+		for i, item := range v {
+			encrypted, err := encryptStruct(item, publicKey, N, encryptKeys)
+
+			if err != nil {
+				return nil, err
+			}
+
+			encryptedList[i] = encrypted
+		}
+		return encryptedList, nil
+	case map[string]interface{}:
+		// For objects, recursively encrypt each key-value pair
+		encryptedObject := make(map[string]interface{})
+		for key, value := range v {
+			encrypted, err := encryptStruct(value, publicKey, N, encryptKeys)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if encryptKeys {
+				key, err = encryptKey(key, publicKey, N)
+
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				key = escapeKey(key)
+			}
+
+			encryptedObject[key] = encrypted
+		}
+		return encryptedObject, nil
+	default:
+		return encryptValue(v, publicKey, N)
+	}
+}
+
+// DecryptStruct recursively decrypts output of EncryptStruct and restores original JSON types.
+// Numbers are returned as json.Number, so they are marshalled back exactly as they were encrypted.
+// Keys must hold public key, every value is decrypted with blinding.
+func DecryptStruct(json interface{}, keys *Keys) (interface{}, error) {
+	// Recursively decrypt the values in a JSON object (including nested structures).
+	switch v := json.(type) {
+	case []interface{}:
+		// For lists, recursively decrypt each item
+		decryptedList := make([]interface{}, len(v))
+		for i, item := range v {
+			decrypted, err := DecryptStruct(item, keys)
+
+			if err != nil {
+				return nil, err
+			}
+
+			decryptedList[i] = decrypted
+		}
+		return decryptedList, nil
+	case map[string]interface{}:
+		if isEncryptedValue(v) {
+			return decryptValue(v, keys)
+		}
+
+		// For objects, recursively decrypt each key-value pair,
+		decryptedObject := make(map[string]interface{})
+		for key, value := range v {
+			decrypted, err := DecryptStruct(value, keys)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if err := setDecryptedKey(decryptedObject, key, decrypted, keys); err != nil {
+				return nil, err
+			}
+		}
+		return decryptedObject, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Value of type %T is not encrypted", json))
+	}
+}
+
+// Encrypts JSON encoding of a single value with OAEP.
+func encryptValue(value interface{}, publicKey, N *big.Int) (interface{}, error) {
+	if err := checkJSONValue(value); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encryptJSON(encoded, valueLabel, publicKey, N)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{encryptedValueKey: encrypted}, nil
+}
+
+// Decrypts encrypted value, its JSON encoding restores the original type.
+func decryptValue(encrypted map[string]interface{}, keys *Keys) (interface{}, error) {
+	decrypted, err := decryptJSON(encrypted[encryptedValueKey].(string), valueLabel, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(decrypted))
+	decoder.UseNumber()
+
+	var value interface{}
+
+	if err := decoder.Decode(&value); err != nil {
+		return nil, errors.New(fmt.Sprintf("Decrypted value is not valid JSON: %s", err))
+	}
+
+	if decoder.More() {
+		return nil, errors.New("Decrypted value holds more than one JSON value")
+	}
+
+	return value, nil
+}
+
+// Encrypts JSON encoding with randomized OAEP and returns hex ciphertext. Encodings which do not fit OAEP
+// are encrypted with AES-GCM and only the AES key is wrapped with OAEP.
+func encryptJSON(encoded, label []byte, publicKey, N *big.Int) (string, error) {
+	capacity := modulusSize(N) - 2*sha256.Size - 2
+
+	if len(encoded) <= capacity {
+		encrypted, err := EncryptOAEP(sha256.New(), rand.Reader, encoded, label, publicKey, N)
+
+		if err != nil {
+			return "", err
+		}
+
+		return hex.EncodeToString(encrypted), nil
+	}
+
+	// AES-256 when its key fits OAEP, otherwise AES-128, like envelopes do.
+	keySize := 32
+	if capacity < keySize {
+		keySize = 16
+	}
+
+	if capacity < keySize {
+		return "", errors.New(fmt.Sprintf(
+			"JSON value of %d bytes cannot be encrypted with %d bit key, at least %d bit is required",
+			len(encoded),
+			N.BitLen(),
+			(16+2*sha256.Size+2)*8,
+		))
+	}
+
+	key, err := aes.GenerateKey(rand.Reader, keySize*8)
+
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := EncryptOAEP(sha256.New(), rand.Reader, key, wrappingLabel(label), publicKey, N)
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aes.GCMNonceSize)
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	header := append(wrappedKey, nonce...)
+	sealed, err := block.SealGCM(encoded, nonce, header)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(append(header, sealed...)), nil
+}
+
+// Decrypts output of encryptJSON.
+func decryptJSON(encrypted string, label []byte, keys *Keys) ([]byte, error) {
+	cipherText, err := hex.DecodeString(encrypted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	k := modulusSize(keys.N)
+
+	if len(cipherText) <= k {
+		return DecryptOAEP(sha256.New(), nil, cipherText, label, keys)
+	}
+
+	if len(cipherText) < k+aes.GCMNonceSize+aes.GCMTagSize {
+		return nil, errors.New("Encrypted value is truncated")
+	}
+
+	key, err := DecryptOAEP(sha256.New(), nil, cipherText[:k], wrappingLabel(label), keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	header := cipherText[:k+aes.GCMNonceSize]
+
+	return block.OpenGCM(cipherText[len(header):], cipherText[k:len(header)], header)
+}
+
+// Label of AES keys wrapped for long values differs from the label of values,
+// so a wrapped key cannot be passed off as a short value and the other way round.
+func wrappingLabel(label []byte) []byte {
+	return append(append([]byte{}, label...), " aes key"...)
+}
+
+// Encrypts object key into a randomized token.
+func encryptKey(key string, publicKey, N *big.Int) (string, error) {
+	encrypted, err := encryptJSON([]byte(key), keyLabel, publicKey, N)
+
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Object key %q cannot be encrypted: %s", key, err))
+	}
+
+	return encryptedKeyPrefix + encrypted, nil
+}
+
+// Decrypts object key produced by encryptKey.
+func decryptKey(token string, keys *Keys) (string, error) {
+	decrypted, err := decryptJSON(strings.TrimPrefix(token, encryptedKeyPrefix), keyLabel, keys)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(decrypted), nil
+}
+
+// Escapes plain object key, so it cannot be taken for a marker.
+func escapeKey(key string) string {
+	if strings.HasPrefix(key, escapePrefix) {
+		return escapePrefix + key
+	}
+
+	return key
+}
+
+// Stores decrypted value under its original key, decrypting the key first when it is a token
+// and removing the escape when it was escaped.
+func setDecryptedKey(object map[string]interface{}, key string, value interface{}, keys *Keys) error {
+	switch {
+	case strings.HasPrefix(key, encryptedKeyPrefix):
+		decryptedKey, err := decryptKey(key, keys)
+
+		if err != nil {
+			return err
+		}
+
+		key = decryptedKey
+	case strings.HasPrefix(key, escapePrefix+escapePrefix):
+		key = key[len(escapePrefix):]
+	case strings.HasPrefix(key, escapePrefix):
+		return errors.New(fmt.Sprintf("Object key %q is reserved and was not produced by encryption", key))
+	}
+
+	if _, exists := object[key]; exists {
+		return errors.New(fmt.Sprintf("Object key %q appears more than once after decryption", key))
+	}
+
+	object[key] = value
+	return nil
+}
+
+// Checks whether object is an encrypted value produced by encryptValue.
+func isEncryptedValue(object map[string]interface{}) bool {
+	if len(object) != 1 {
+		return false
+	}
+
+	_, valueIsString := object[encryptedValueKey].(string)
+
+	return valueIsString
+}
+
+// Checks that value is one of the types encoding/json decodes JSON into. Objects and arrays
+// are encrypted as one value only by EncryptFields, EncryptStruct always descends into them.
+func checkJSONValue(value interface{}) error {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}, string, float64, json.Number, int, bool, nil:
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("Unsupported json type: %T", value))
+	}
+}